@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Share of the cgroup memory limit the buffers may take without --max-memory
+// The rest is left to the Go runtime, the file lists and whatever else runs in the container
+const cgroupMemoryShare = 4
+
+// Mount point of the cgroup v2 hierarchy
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupMemoryLimit returns the memory.max of the cgroup v2 the process runs in, 0 when there is none
+// Limits of parent cgroups apply too, so the lowest one on the way to the root wins
+// Without a cgroup v2, e.g. on cgroup v1 or outside of Linux, there is no limit
+func cgroupMemoryLimit() (int64, error) {
+	file, err := os.Open("/proc/self/cgroup")
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	// The cgroup v2 entry is the one with hierarchy 0 and no controllers, e.g. 0::/kubepods/pod1234
+	group := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if rest, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			group = rest
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if group == "" {
+		return 0, nil
+	}
+
+	var limit int64
+	for group = path.Clean("/" + group); ; group = path.Dir(group) {
+		data, err := os.ReadFile(filepath.Join(cgroupRoot, group, "memory.max"))
+		// The root cgroup has no memory.max, neither have groups without the memory controller
+		if err == nil {
+			value := strings.TrimSpace(string(data))
+			if value != "max" {
+				groupLimit, err := strconv.ParseInt(value, 10, 64)
+				if err != nil {
+					return 0, &os.PathError{Op: "parse", Path: filepath.Join(cgroupRoot, group, "memory.max"), Err: err}
+				}
+				if limit == 0 || groupLimit < limit {
+					limit = groupLimit
+				}
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return 0, err
+		}
+		if group == "/" {
+			return limit, nil
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"file_warmer/warmer"
+)
+
+// runStat is fwup stat, it reports the size of the files and how much of them is in page cache, without warming anything
+func runStat(args []string) int {
+	flags := flag.NewFlagSet("stat", flag.ExitOnError)
+	recursiveFlag := flags.Bool("recursive", false, "Descend into subdirectories of directories given as input")
+	followSymlinksFlag := flags.Bool("follow-symlinks", false, "Report the targets of symlinks in the input, they are skipped by default")
+	var excludes stringList
+	flags.Var(&excludes, "exclude", "Skip paths found in directories matching this glob, on the base name or the relative path (repeatable)")
+	jsonFlag := flags.Bool("json", false, "Print the files as a JSON array instead of a table")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s stat [flags] path...\n\nReports the size and page cache residency of the files, directories are walked for the files in them.\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	logger := warmer.NewLogger(os.Stderr, warmer.LevelWarn)
+	filePaths, collectErr := collectFilePaths(expandGlobs(flags.Args(), logger), *recursiveFlag, *followSymlinksFlag, excludes, defaultWalkWorkers, logger)
+	residencies, err := warmer.Residency(filePaths)
+	if collectErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", collectErr)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+
+	if *jsonFlag {
+		if residencies == nil {
+			residencies = []warmer.FileResidency{}
+		}
+		if err := writeJSON(os.Stdout, residencies); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing stats: %v\n", err)
+			return exitFailure
+		}
+	} else {
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "Path\tSize (MB)\tCached (MB)\tCached (%)")
+		var total warmer.FileResidency
+		for _, residency := range residencies {
+			fmt.Fprintf(writer, "%s\t%.2f\t%.2f\t%.1f\n", residency.Path, float64(residency.SizeBytes)/1024/1024, float64(residency.ResidentBytes)/1024/1024, residentPercent(residency))
+			total.SizeBytes += residency.SizeBytes
+			total.ResidentBytes += residency.ResidentBytes
+		}
+		fmt.Fprintf(writer, "All %d files\t%.2f\t%.2f\t%.1f\n", len(residencies), float64(total.SizeBytes)/1024/1024, float64(total.ResidentBytes)/1024/1024, residentPercent(total))
+		writer.Flush()
+	}
+
+	if collectErr != nil || err != nil {
+		return exitFailure
+	}
+	return exitSuccess
+}
+
+// runVerify is fwup verify, it reads the entries of a manifest with O_DIRECT and checks them against their checksums
+// Reading around page cache leaves the cache as it was, the pass only tells if the data is intact
+func runVerify(args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	blockSizeFlag := flags.String("block-size", "256K", "Size of each block read, e.g. 64K, 1M, 4M (must be a multiple of 512)")
+	workersFlag := flags.Int("workers", 0, "Number of workers reading blocks of large files (default: derived from CPU count)")
+	maxRateFlag := flags.String("max-rate", "", "Cap the combined read rate of all workers per second, e.g. 200M (default: unlimited)")
+	quietFlag := flags.Bool("quiet", false, "Only log the entries that failed")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s verify [flags] manifest\n\nChecks the files of a manifest, as given to --manifest, against their sha256 without warming them.\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	blockSize, err := parseSize(*blockSizeFlag)
+	if err == nil {
+		err = warmer.ValidateBlockSize(blockSize)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --block-size %q: %v\n", *blockSizeFlag, err)
+		return exitUsage
+	}
+	if *workersFlag < 0 {
+		fmt.Fprintf(os.Stderr, "Invalid --workers %d: must not be negative\n", *workersFlag)
+		return exitUsage
+	}
+	workers := *workersFlag
+	if workers == 0 {
+		workers = defaultWorkerCount()
+	}
+	var maxRate int64
+	if *maxRateFlag != "" {
+		maxRate, err = parseSize(*maxRateFlag)
+		if err != nil || maxRate <= 0 {
+			fmt.Fprintf(os.Stderr, "Invalid --max-rate %q: must be a positive rate, e.g. 200M\n", *maxRateFlag)
+			return exitUsage
+		}
+	}
+
+	entries, err := readManifest(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading manifest: %v\n", err)
+		return exitUsage
+	}
+	ranges := make(map[string]warmer.ByteRange)
+	paths, checksums := addManifest(entries, nil, ranges, nil)
+	if checksums == nil {
+		fmt.Fprintln(os.Stderr, "Invalid manifest: none of its entries has a sha256 to verify")
+		return exitUsage
+	}
+
+	level := warmer.LevelWarn
+	if *quietFlag {
+		level = warmer.LevelError
+	}
+	logger := warmer.NewLogger(os.Stdout, level)
+	// Missing files show up as failed entries, like any other file that can't be read
+	if err := missingEntries(entries); err != nil {
+		logger.Warnf("Files of the manifest are missing: %v\n", err)
+	}
+
+	ctx, stop := notifySignals(context.Background())
+	defer stop()
+	stats, err := warmer.Warm(ctx, paths, warmer.Options{
+		Method:                 warmer.PosixSync,
+		SmallFileSizeThreshold: defaultSmallFileSizeThreshold,
+		SmallFilesWorkerCount:  defaultSmallFilesWorkerCount,
+		LargeFilesWorkerCount:  workers,
+		BlockSizeForSmallFiles: blockSize,
+		BlockSizeForLargeFiles: blockSize,
+		Checksums:              checksums,
+		Ranges:                 ranges,
+		MaxRate:                maxRate,
+		Logger:                 logger,
+	})
+
+	// The report is the output of the command, it's logged whatever the level
+	report := warmer.NewLogger(os.Stdout, warmer.LevelInfo)
+	if *quietFlag {
+		report = logger
+	}
+	logManifestReport(report, entries, stats)
+	return exitCode(stats, err)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// Environment variables that settings fall back to, for deployments where flags are awkward
+var envFlags = []struct {
+	env  string
+	flag string
+}{
+	{"FWUP_WORKERS", "workers"},
+	{"FWUP_BLOCK_SIZE", "block-size"},
+	{"FWUP_BACKEND", "backend"},
+	{"FWUP_MAX_RATE", "max-rate"},
+}
+
+// loadConfig applies the environment to flags that weren't given on the command line
+// So flags override the environment, which overrides the defaults
+// Values go through the flags, they are parsed and validated the same way
+func loadConfig(flags *flag.FlagSet, getenv func(string) string) error {
+	given := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	for _, envFlag := range envFlags {
+		value := getenv(envFlag.env)
+		if value == "" || given[envFlag.flag] {
+			continue
+		}
+		if err := flags.Set(envFlag.flag, value); err != nil {
+			return fmt.Errorf("invalid %s=%q: %w", envFlag.env, value, err)
+		}
+	}
+	return nil
+}
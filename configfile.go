@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configValue is the value of a key of a config file, a scalar or a list of scalars
+type configValue struct {
+	line   int
+	values []string
+	isList bool
+}
+
+func (v *configValue) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	v.line = node.Line
+	switch node.Kind {
+	case yaml.ScalarNode:
+		v.values = []string{node.Value}
+	case yaml.SequenceNode:
+		v.isList = true
+		v.values = []string{}
+		for _, item := range node.Content {
+			if item.Kind == yaml.AliasNode {
+				item = item.Alias
+			}
+			if item.Kind != yaml.ScalarNode {
+				return fmt.Errorf("line %d: lists can only hold plain values", item.Line)
+			}
+			if isNull(item) {
+				return fmt.Errorf("line %d: empty list item", item.Line)
+			}
+			v.values = append(v.values, item.Value)
+		}
+	default:
+		return fmt.Errorf("line %d: expected a value or a list, not a section", node.Line)
+	}
+	return nil
+}
+
+// configFile holds the types a config file is decoded into, a struct with a field per flag so that unknown keys are errors
+// The top level also takes paths, and sections, mappings grouping flags under a name of their own
+type configFile struct {
+	section reflect.Type
+	file    reflect.Type
+	flags   []string
+}
+
+func newConfigFile(flags *flag.FlagSet) configFile {
+	var c configFile
+	var fields []reflect.StructField
+	flags.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+		fields = append(fields, reflect.StructField{
+			Name: fmt.Sprintf("Flag%d", len(fields)),
+			Type: reflect.TypeOf(configValue{}),
+			Tag:  reflect.StructTag(fmt.Sprintf("yaml:%q", f.Name)),
+		})
+		c.flags = append(c.flags, f.Name)
+	})
+	c.section = reflect.StructOf(fields)
+	c.file = reflect.StructOf([]reflect.StructField{
+		{Name: "Flags", Type: c.section, Tag: `yaml:",inline"`},
+		{Name: "Paths", Type: reflect.TypeOf(configValue{}), Tag: `yaml:"paths"`},
+		{Name: "Sections", Type: reflect.MapOf(reflect.TypeOf(""), c.section), Tag: `yaml:",inline"`},
+	})
+	return c
+}
+
+// loadConfigFile applies a YAML config file to the flags that weren't set yet, on the command line or by the environment
+// Top-level keys are flag names, and so are the keys of sections, mappings grouping flags under a name of their own
+// Repeatable flags like exclude take a list, paths lists the paths or globs to warm when none are given as arguments
+// Unknown keys are errors, a typo shouldn't silently fall back to a default
+func loadConfigFile(flags *flag.FlagSet, name string) ([]string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := applyConfigFile(flags, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return paths, nil
+}
+
+func applyConfigFile(flags *flag.FlagSet, data []byte) ([]string, error) {
+	config := newConfigFile(flags)
+
+	// The sections are applied in the order of the file, which a map doesn't keep
+	var root yaml.Node
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&root); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	document := root.Content[0]
+	if isNull(document) {
+		return nil, nil
+	}
+	if document.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected keys, e.g. backend: io_uring", document.Line)
+	}
+	var sections []string
+	for i := 0; i < len(document.Content); i += 2 {
+		key, value := document.Content[i], document.Content[i+1]
+		if err := checkConfigValue(key, value); err != nil {
+			return nil, err
+		}
+		if key.Value == "paths" || config.isFlag(key.Value) {
+			continue
+		}
+		if value.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("line %d: unknown key %q", key.Line, key.Value)
+		}
+		for j := 0; j < len(value.Content); j += 2 {
+			if err := checkConfigValue(value.Content[j], value.Content[j+1]); err != nil {
+				return nil, err
+			}
+		}
+		sections = append(sections, key.Value)
+	}
+
+	file := reflect.New(config.file)
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(file.Interface()); err != nil {
+		return nil, configError(err)
+	}
+
+	given := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	if err := config.apply(flags, given, file.Elem().Field(0)); err != nil {
+		return nil, err
+	}
+	for _, name := range sections {
+		section := file.Elem().Field(2).MapIndex(reflect.ValueOf(name))
+		if err := config.apply(flags, given, section); err != nil {
+			return nil, err
+		}
+	}
+	return file.Elem().Field(1).Interface().(configValue).values, nil
+}
+
+// checkConfigValue rejects keys without a value, which decoding would take as not being there
+func checkConfigValue(key, value *yaml.Node) error {
+	if isNull(value) {
+		return fmt.Errorf("line %d: %s has no value", key.Line, key.Value)
+	}
+	return nil
+}
+
+func isNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
+
+func (c configFile) isFlag(name string) bool {
+	for _, flagName := range c.flags {
+		if flagName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// apply sets the flags of a section, or of the top level, that are in the file and weren't given otherwise
+func (c configFile) apply(flags *flag.FlagSet, given map[string]bool, section reflect.Value) error {
+	for i, name := range c.flags {
+		value := section.Field(i).Interface().(configValue)
+		if value.line == 0 {
+			continue
+		}
+		if _, repeatable := flags.Lookup(name).Value.(*stringList); value.isList && !repeatable {
+			return fmt.Errorf("line %d: %s takes a single value, not a list", value.line, name)
+		}
+		if given[name] {
+			continue
+		}
+		for _, v := range value.values {
+			if err := flags.Set(name, v); err != nil {
+				return fmt.Errorf("line %d: invalid %s %q: %w", value.line, name, v, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configError drops the Go types yaml names in its errors, the struct of all flags isn't something to show
+func configError(err error) error {
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return err
+	}
+	messages := make([]string, len(typeErr.Errors))
+	for i, message := range typeErr.Errors {
+		if line, name, ok := strings.Cut(message, ": field "); ok {
+			name, _, _ = strings.Cut(name, " not found in type ")
+			message = fmt.Sprintf("%s: unknown key %q", line, name)
+		} else {
+			message, _, _ = strings.Cut(message, " into ")
+		}
+		messages[i] = message
+	}
+	return errors.New(strings.Join(messages, ", "))
+}
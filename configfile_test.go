@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newConfigFlags() (*flag.FlagSet, *stringList) {
+	flags := flag.NewFlagSet("fwup", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.String("backend", "psync", "")
+	flags.String("block-size", "256K", "")
+	flags.Int("workers", 0, "")
+	flags.Bool("no-direct", false, "")
+	flags.String("config", "", "")
+	var excludes stringList
+	flags.Var(&excludes, "exclude", "")
+	return flags, &excludes
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	flags, excludes := newConfigFlags()
+	if err := flags.Parse([]string{"--workers", "8"}); err != nil {
+		t.Fatal(err)
+	}
+	config := `
+# Comments go anywhere
+backend: io_uring # trailing ones too
+workers: 2
+paths:
+  - /data/a
+  - "/data/b #1"
+tuning:
+  block-size: &size 1M
+  no-direct: true
+filters:
+  exclude: ['*.tmp', ".git/"]
+`
+	paths, err := applyConfigFile(flags, []byte(config))
+	if err != nil {
+		t.Fatalf("applyConfigFile: %v", err)
+	}
+	if want := []string{"/data/a", "/data/b #1"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("paths = %q, want %q", paths, want)
+	}
+	for name, want := range map[string]string{
+		"backend":    "io_uring",
+		"block-size": "1M",
+		"no-direct":  "true",
+		// Given on the command line, which takes precedence
+		"workers": "8",
+	} {
+		if got := flags.Lookup(name).Value.String(); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if want := (stringList{"*.tmp", ".git/"}); !reflect.DeepEqual(*excludes, want) {
+		t.Errorf("exclude = %q, want %q", *excludes, want)
+	}
+}
+
+func TestApplyConfigFileEmpty(t *testing.T) {
+	for _, config := range []string{"", "# nothing yet\n", "---\n"} {
+		flags, _ := newConfigFlags()
+		paths, err := applyConfigFile(flags, []byte(config))
+		if err != nil || paths != nil {
+			t.Errorf("applyConfigFile(%q) = %q, %v, want no paths and no error", config, paths, err)
+		}
+	}
+}
+
+func TestApplyConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{"unknown key", "backend: psync\nbakend: io_uring\n", `line 2: unknown key "bakend"`},
+		{"unknown key in section", "tuning:\n  workers: 2\n  wrokers: 4\n", `line 3: unknown key "wrokers"`},
+		{"nested section", "tuning:\n  more:\n    workers: 2\n", `line 2: unknown key "more"`},
+		{"paths in section", "inputs:\n  paths: [/data]\n", `line 2: unknown key "paths"`},
+		{"config key", "config: other.yaml\n", `line 1: unknown key "config"`},
+		{"list for single value", "backend: [psync, mmap]\n", "line 1: backend takes a single value, not a list"},
+		{"section for value", "backend:\n  name: psync\n", "line 2: expected a value or a list, not a section"},
+		{"empty value", "backend:\n", "line 1: backend has no value"},
+		{"invalid value", "workers: many\n", `line 1: invalid workers "many"`},
+		{"not a mapping", "- backend\n", "line 1: expected keys"},
+		{"set twice", "workers: 1\nworkers: 2\n", "already defined"},
+		{"empty list item", "exclude:\n  - a\n  -\n", "line 3: empty list item"},
+		{"nested list", "exclude:\n  - [a, b]\n", "line 2: lists can only hold plain values"},
+		{"bad syntax", "backend: \"psync\n", "yaml:"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			flags, _ := newConfigFlags()
+			_, err := applyConfigFile(flags, []byte(test.config))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("applyConfigFile(%q) = %v, want an error with %q", test.config, err, test.want)
+			}
+		})
+	}
+}
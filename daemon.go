@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"file_warmer/warmer"
+)
+
+// Socket the daemon listens on and fwup submit connects to by default
+const defaultSocketPath = "/run/fwup.sock"
+
+// Jobs waiting for their turn, submissions beyond are rejected
+const daemonQueueSize = 64
+
+// How often a running job reports its progress to the client
+const daemonProgressInterval = time.Second
+
+// daemonJob is a line sent by a client, the paths are resolved like arguments of the CLI
+type daemonJob struct {
+	Paths   []string   `json:"paths"`
+	Options jobOptions `json:"options"`
+}
+
+// jobOptions override the options the daemon was started with, for a single job
+// Sizes and durations take the same values as the flags of the same name
+type jobOptions struct {
+	Backend     string `json:"backend,omitempty"`
+	BlockSize   string `json:"block_size,omitempty"`
+	Workers     int    `json:"workers,omitempty"`
+	MaxRate     string `json:"max_rate,omitempty"`
+	Head        string `json:"head,omitempty"`
+	Tail        string `json:"tail,omitempty"`
+	FileTimeout string `json:"file_timeout,omitempty"`
+	NoDirect    *bool  `json:"no_direct,omitempty"`
+	SkipCached  *bool  `json:"skip_cached,omitempty"`
+	SkipHoles   *bool  `json:"skip_holes,omitempty"`
+	Recursive   bool   `json:"recursive,omitempty"`
+}
+
+// daemonEvent is a line sent back to the client, the last one of a job is a result or an error
+type daemonEvent struct {
+	Type       string         `json:"type"`
+	Job        int64          `json:"job,omitempty"`
+	Position   int            `json:"position,omitempty"`
+	BytesRead  int64          `json:"bytes_read,omitempty"`
+	BytesTotal int64          `json:"bytes_total,omitempty"`
+	FilesDone  int64          `json:"files_done,omitempty"`
+	FilesTotal int64          `json:"files_total,omitempty"`
+	Result     *warmer.Result `json:"result,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// queuedJob is a job accepted by the daemon, its events go to the connection that submitted it
+type queuedJob struct {
+	id        int64
+	ctx       context.Context
+	filePaths []string
+	opts      warmer.Options
+	// Never closed, the result or error event is the last one
+	events chan daemonEvent
+}
+
+// daemon runs the jobs submitted over its socket one after the other, in the order they came in
+// Running one job at a time keeps the disks from being shared by unrelated warmups
+// The jobs share a pool of workers, so a job doesn't set up buffers and rings the previous one already had
+type daemon struct {
+	opts   warmer.Options
+	logger *warmer.Logger
+	jobs   chan *queuedJob
+	nextID atomic.Int64
+	queued atomic.Int64
+}
+
+// runDaemon serves jobs on the socket until ctx is done, the job running then is cancelled
+// A stale socket of a previous daemon is replaced, a live one is left alone
+func runDaemon(ctx context.Context, socketPath string, opts warmer.Options, logger *warmer.Logger) int {
+	if conn, err := net.Dial("unix", socketPath); err == nil {
+		conn.Close()
+		fmt.Fprintf(os.Stderr, "Error: a daemon is already listening on %s\n", socketPath)
+		return exitFailure
+	}
+	if err := os.Remove(socketPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "Error removing stale socket: %v\n", err)
+		return exitFailure
+	}
+	// Jobs read files with the permissions of the daemon, so only its user may submit them
+	// The socket is created with the mode already, the process runs nothing else yet that the umask would affect
+	umask := setUmask(0o177)
+	listener, err := net.Listen("unix", socketPath)
+	setUmask(umask)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listening: %v\n", err)
+		return exitFailure
+	}
+	defer listener.Close()
+
+	pool := warmer.NewPool()
+	defer pool.Close()
+	opts.Pool = pool
+	d := &daemon{opts: opts, logger: logger, jobs: make(chan *queuedJob, daemonQueueSize)}
+	go d.runJobs(ctx)
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	logger.Infof("Listening for jobs on %s\n", socketPath)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				logger.Infof("Daemon stopped: %v\n", context.Cause(ctx))
+				return exitSuccess
+			}
+			logger.Errorf("Error accepting connection: %v\n", err)
+			continue
+		}
+		go d.serve(ctx, conn)
+	}
+}
+
+// serve reads jobs from the connection, each one is waited for before the next line is read
+// A client going away cancels its job, noticed once sending it progress fails
+func (d *daemon) serve(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	encoder := json.NewEncoder(conn)
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		jobCtx, cancel := context.WithCancel(ctx)
+		job, err := d.submit(jobCtx, scanner.Bytes())
+		if err != nil {
+			cancel()
+			if encoder.Encode(daemonEvent{Type: "error", Error: err.Error()}) != nil {
+				return
+			}
+			continue
+		}
+
+		// Once the client is gone the events are only drained, until the cancelled job ends
+		gone := false
+		for event := range job.events {
+			if !gone {
+				if err := encoder.Encode(event); err != nil {
+					d.logger.Warnf("Job %d: client went away, cancelling: %v\n", job.id, err)
+					cancel()
+					gone = true
+				}
+			}
+			if event.Type == "result" || event.Type == "error" {
+				break
+			}
+		}
+		cancel()
+		if gone {
+			return
+		}
+	}
+}
+
+// submit parses a job and queues it
+func (d *daemon) submit(ctx context.Context, line []byte) (*queuedJob, error) {
+	var submitted daemonJob
+	if err := json.Unmarshal(line, &submitted); err != nil {
+		return nil, fmt.Errorf("invalid job: %w", err)
+	}
+	if len(submitted.Paths) == 0 {
+		return nil, errors.New("invalid job: no paths")
+	}
+	opts, err := submitted.Options.apply(d.opts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid job options: %w", err)
+	}
+
+	// Relative paths would depend on where the daemon was started
+	for _, path := range submitted.Paths {
+		if !filepath.IsAbs(path) {
+			return nil, fmt.Errorf("invalid job: path %s is not absolute", path)
+		}
+	}
+	ranges := make(map[string]warmer.ByteRange)
+	paths, err := splitRanges(submitted.Paths, ranges)
+	if err != nil {
+		return nil, fmt.Errorf("invalid job: %w", err)
+	}
+	opts.Ranges = ranges
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid job options: %w", err)
+	}
+	// Paths that can't be walked show up as failed files of the job
+	filePaths, _ := collectFilePaths(paths, submitted.Options.Recursive, false, nil, defaultWalkWorkers, d.logger)
+
+	job := &queuedJob{
+		id:        d.nextID.Add(1),
+		ctx:       ctx,
+		filePaths: filePaths,
+		opts:      opts,
+		events:    make(chan daemonEvent, 16),
+	}
+	// Counted before the job can be taken off the queue, so the count never goes below the jobs waiting
+	position := int(d.queued.Add(1))
+	select {
+	case d.jobs <- job:
+	default:
+		d.queued.Add(-1)
+		return nil, fmt.Errorf("queue full, %d jobs waiting", daemonQueueSize)
+	}
+	job.events <- daemonEvent{Type: "queued", Job: job.id, Position: position}
+	d.logger.Infof("Job %d: queued %d files at position %d\n", job.id, len(filePaths), position)
+	return job, nil
+}
+
+// runJobs runs the queued jobs one after the other until ctx is done
+func (d *daemon) runJobs(ctx context.Context) {
+	for {
+		var job *queuedJob
+		select {
+		case job = <-d.jobs:
+		case <-ctx.Done():
+			return
+		}
+		d.queued.Add(-1)
+		if job.ctx.Err() != nil {
+			job.events <- daemonEvent{Type: "error", Job: job.id, Error: "cancelled before it started"}
+			continue
+		}
+		d.run(job)
+	}
+}
+
+func (d *daemon) run(job *queuedJob) {
+	startTime := time.Now()
+	d.logger.Infof("Job %d: warming %d files\n", job.id, len(job.filePaths))
+	counters := &warmer.Counters{}
+	job.opts.Counters = counters
+
+	// Progress is dropped while the client is slow to read it, the result never is
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(daemonProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+			select {
+			case job.events <- daemonEvent{
+				Type:       "progress",
+				Job:        job.id,
+				BytesRead:  counters.BytesRead.Load(),
+				BytesTotal: counters.BytesTotal.Load(),
+				FilesDone:  counters.FilesDone.Load(),
+				FilesTotal: counters.FilesTotal.Load(),
+			}:
+			default:
+			}
+		}
+	}()
+
+	result, err := warmer.Warm(job.ctx, job.filePaths, job.opts)
+	close(done)
+	event := daemonEvent{Type: "result", Job: job.id, Result: &result}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	d.logger.Infof("Job %d: done in %v, %d of %d files failed\n", job.id, time.Since(startTime).Round(time.Millisecond), result.FailedFiles, result.FileCount)
+	job.events <- event
+}
+
+// apply returns opts with the options set for the job
+func (o jobOptions) apply(opts warmer.Options) (warmer.Options, error) {
+	if o.Backend != "" {
+		opts.Method = warmer.FileIOMethod(o.Backend)
+		if o.Backend == "iouring" {
+			opts.Method = warmer.IOUring
+		}
+	}
+	if o.BlockSize != "" {
+		blockSize, err := parseSize(o.BlockSize)
+		if err != nil {
+			return opts, fmt.Errorf("block_size: %w", err)
+		}
+		opts.BlockSizeForSmallFiles, opts.BlockSizeForLargeFiles = blockSize, blockSize
+	}
+	if o.Workers != 0 {
+		opts.LargeFilesWorkerCount = o.Workers
+	}
+	if o.MaxRate != "" {
+		maxRate, err := parseSize(o.MaxRate)
+		if err != nil {
+			return opts, fmt.Errorf("max_rate: %w", err)
+		}
+		opts.MaxRate = maxRate
+	}
+	if o.Head != "" {
+		head, err := parseSize(o.Head)
+		if err != nil {
+			return opts, fmt.Errorf("head: %w", err)
+		}
+		opts.Head = head
+	}
+	if o.Tail != "" {
+		tail, err := parseSize(o.Tail)
+		if err != nil {
+			return opts, fmt.Errorf("tail: %w", err)
+		}
+		opts.Tail = tail
+	}
+	if o.FileTimeout != "" {
+		fileTimeout, err := time.ParseDuration(o.FileTimeout)
+		if err != nil {
+			return opts, fmt.Errorf("file_timeout: %w", err)
+		}
+		opts.FileTimeout = fileTimeout
+	}
+	if o.NoDirect != nil {
+		opts.NoDirect = *o.NoDirect
+	}
+	if o.SkipCached != nil {
+		opts.SkipCached = *o.SkipCached
+	}
+	if o.SkipHoles != nil {
+		opts.SkipHoles = *o.SkipHoles
+	}
+	return opts, nil
+}
+
+// runSubmit is fwup submit, it sends a job to the daemon and prints the events it gets back as JSON lines
+// Exits like a warmup run by the CLI would, going by the result of the job
+func runSubmit(args []string) int {
+	flags := flag.NewFlagSet("submit", flag.ExitOnError)
+	socketFlag := flags.String("socket", defaultSocketPath, "Unix socket of the daemon")
+	optionsFlag := flags.String("options", "", `Options of the job as JSON, e.g. '{"block_size": "1M", "no_direct": true}'`)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s submit [flags] path...\n\nQueues a warmup with the daemon started with --daemon and waits for it.\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	job := daemonJob{}
+	if *optionsFlag != "" {
+		if err := json.Unmarshal([]byte(*optionsFlag), &job.Options); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --options: %v\n", err)
+			return exitUsage
+		}
+	}
+	for _, path := range flags.Args() {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid path: %v\n", err)
+			return exitUsage
+		}
+		job.Paths = append(job.Paths, path)
+	}
+
+	conn, err := net.Dial("unix", *socketFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error connecting to the daemon: %v\n", err)
+		return exitFailure
+	}
+	defer conn.Close()
+	if err := json.NewEncoder(conn).Encode(job); err != nil {
+		fmt.Fprintf(os.Stderr, "Error submitting job: %v\n", err)
+		return exitFailure
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		fmt.Println(scanner.Text())
+		var event daemonEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading from the daemon: %v\n", err)
+			return exitFailure
+		}
+		switch event.Type {
+		case "error":
+			fmt.Fprintf(os.Stderr, "Error: %s\n", event.Error)
+			return exitFailure
+		case "result":
+			if event.Error != "" {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", event.Error)
+				return exitFailure
+			}
+			if event.Result.FailedFiles > 0 {
+				return exitFailure
+			}
+			return exitSuccess
+		}
+	}
+	fmt.Fprintln(os.Stderr, "Error: the daemon closed the connection before the job was done")
+	return exitFailure
+}
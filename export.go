@@ -0,0 +1,55 @@
+package main
+
+// #include <stdlib.h>
+import "C"
+import (
+	"context"
+	"os"
+	"unsafe"
+
+	"file_warmer/warmer"
+)
+
+// WarmupFiles returns NULL on success, otherwise an error message
+// The caller owns the returned string and must release it with FreeError
+//
+//export WarmupFiles
+func WarmupFiles(filePaths **C.char, filePathCount C.int, method *C.char, smallFileSizeThreshold C.long, blockSizeForSmallFiles C.long, blockSizeForLargeFiles C.long, smallFilesWorkerCount C.int, largeFilesWorkerCount C.int) *C.char {
+	// Convert the C char array back to a Go slice
+	length := int(filePathCount)
+	tmpSlice := (*[1 << 30]*C.char)(unsafe.Pointer(filePaths))[:length:length]
+	goFilePaths := make([]string, length)
+	for i := 0; i < length; i++ {
+		goFilePaths[i] = C.GoString(tmpSlice[i])
+	}
+
+	// Call the Go function with converted values
+	err := warmupFiles(goFilePaths, warmer.FileIOMethod(C.GoString(method)), int64(smallFileSizeThreshold), int64(blockSizeForSmallFiles), int64(blockSizeForLargeFiles), int(smallFilesWorkerCount), int(largeFilesWorkerCount))
+	if err != nil {
+		return C.CString(err.Error())
+	}
+	return nil
+}
+
+//export FreeError
+func FreeError(err *C.char) {
+	C.free(unsafe.Pointer(err))
+}
+
+func warmupFiles(filePaths []string, method warmer.FileIOMethod, smallFileSizeThreshold int64, blockSizeForSmallFiles int64, blockSizeForLargeFiles int64, smallFilesWorkerCount int, largeFilesWorkerCount int) error {
+	var logger = warmer.NewLogger(os.Stdout, warmer.LevelInfo)
+	stats, err := warmer.Warm(context.Background(), filePaths, warmer.Options{
+		Method:                 method,
+		SmallFileSizeThreshold: smallFileSizeThreshold,
+		BlockSizeForSmallFiles: blockSizeForSmallFiles,
+		BlockSizeForLargeFiles: blockSizeForLargeFiles,
+		SmallFilesWorkerCount:  smallFilesWorkerCount,
+		LargeFilesWorkerCount:  largeFilesWorkerCount,
+		Retries:                warmer.DefaultReadRetries,
+		Logger:                 logger,
+	})
+	if stats.FileCount > 0 {
+		logStats(logger, stats)
+	}
+	return err
+}
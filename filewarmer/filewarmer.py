@@ -11,7 +11,7 @@ class FWUP:
     def warmup(
         self,
         file_paths: List[str],
-        method: Literal["psync", "io_uring"] = "psync",
+        method: Literal["psync", "io_uring", "readahead", "mmap", "willneed"] = "psync",
         small_file_size_threshold: int = 1024 * 1024,  # 1MB
         block_size_for_small_files: int = 256 * 1024,  # 256KB
         block_size_for_large_files: int = 256 * 1024,  # 256KB
@@ -33,7 +33,7 @@ class FWUP:
         )
 
         # Call the C function with converted arguments
-        self.lib.WarmupFiles(
+        err = self.lib.WarmupFiles(
             list_ptr,
             ctypes.c_int(len(file_paths)),
             ctypes.c_char_p(method.encode("utf-8")),
@@ -43,6 +43,10 @@ class FWUP:
             ctypes.c_int(small_files_worker_count),
             ctypes.c_int(large_files_worker_count),
         )
+        if err:
+            message = ctypes.string_at(err).decode("utf-8")
+            self.lib.FreeError(err)
+            raise RuntimeError(message)
 
     def load_shared_library(self):
         try:
@@ -58,7 +62,10 @@ class FWUP:
                 ctypes.c_int,  # smallFilesWorkerCount
                 ctypes.c_int,  # largeFilesWorkerCount
             ]
-            self.lib.WarmupFiles.restype = None  # void return type
+            # Error message or NULL, must be released with FreeError
+            self.lib.WarmupFiles.restype = ctypes.c_void_p
+            self.lib.FreeError.argtypes = [ctypes.c_void_p]
+            self.lib.FreeError.restype = None
 
         except (OSError, RuntimeError) as e:
             raise ImportError(f"Failed to load the WarmupFiles library: {e}")
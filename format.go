@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+
+	"file_warmer/warmer"
+)
+
+// statsFormatter writes the stats of a warmup, or the plan of a dry run, in one of the --format output formats
+// The logger logs to w, the text format is the regular log output
+type statsFormatter interface {
+	// writeStats writes the stats of the runs, there are several with --repeat
+	writeStats(w io.Writer, logger *warmer.Logger, runs []warmer.Result, fileStats bool) error
+	writePlan(w io.Writer, logger *warmer.Logger, plan warmer.Plan) error
+}
+
+// Formats other than text are meant for machines, logs go to stderr so stdout only has the output
+var formatters = map[string]statsFormatter{
+	"text": textFormatter{},
+	"json": jsonFormatter{},
+	"csv":  csvFormatter{},
+}
+
+type textFormatter struct{}
+
+// A single report is only logged when there were files
+func (textFormatter) writeStats(w io.Writer, logger *warmer.Logger, runs []warmer.Result, fileStats bool) error {
+	if len(runs) > 1 {
+		logRepeatReport(logger, newRepeatReport(runs))
+		return nil
+	}
+	if stats := runs[0]; stats.FileCount > 0 {
+		if fileStats {
+			logFileStats(logger, stats.Files)
+		}
+		logStats(logger, stats)
+	}
+	return nil
+}
+
+func (textFormatter) writePlan(w io.Writer, logger *warmer.Logger, plan warmer.Plan) error {
+	logPlan(logger, plan)
+	return nil
+}
+
+// failuresPath is the --write-failures file, named in the output when given
+type jsonFormatter struct {
+	failuresPath string
+}
+
+// jsonStats is the output of a single run, the stats and where their failures were written
+type jsonStats struct {
+	warmer.Result
+	FailuresPath string `json:"failures_path,omitempty"`
+}
+
+// The per file stats are always part of the JSON output
+func (f jsonFormatter) writeStats(w io.Writer, logger *warmer.Logger, runs []warmer.Result, fileStats bool) error {
+	if len(runs) > 1 {
+		report := newRepeatReport(runs)
+		report.FailuresPath = f.failuresPath
+		return writeJSON(w, report)
+	}
+	return writeJSON(w, jsonStats{Result: runs[0], FailuresPath: f.failuresPath})
+}
+
+func (jsonFormatter) writePlan(w io.Writer, logger *warmer.Logger, plan warmer.Plan) error {
+	return writeJSON(w, plan)
+}
+
+// csvFormatter writes a row per file and a summary row with the status total and no path
+// The columns are documented in the README, new ones only ever go at the end
+type csvFormatter struct{}
+
+var (
+	csvStatsHeader = []string{"path", "size_bytes", "duration_ms", "throughput_mb_s", "status"}
+	csvPlanHeader  = []string{"path", "size_bytes", "warm_bytes", "blocks", "status"}
+)
+
+// With --repeat every run has its rows, each ending with its summary row
+func (csvFormatter) writeStats(w io.Writer, logger *warmer.Logger, runs []warmer.Result, fileStats bool) error {
+	writer := csv.NewWriter(w)
+	writer.Write(csvStatsHeader)
+	for _, stats := range runs {
+		for _, file := range stats.Files {
+			writer.Write([]string{file.Path, formatInt(file.SizeBytes), formatFloat(file.DurationSeconds * 1000), formatFloat(file.ThroughputMBs), fileStatus(file)})
+		}
+		writer.Write([]string{"", formatInt(stats.TotalBytes), formatFloat(stats.TotalSeconds * 1000), formatFloat(stats.ThroughputMBs), "total"})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (csvFormatter) writePlan(w io.Writer, logger *warmer.Logger, plan warmer.Plan) error {
+	writer := csv.NewWriter(w)
+	writer.Write(csvPlanHeader)
+	for _, file := range plan.Files {
+		status := "ok"
+		if file.Error != "" {
+			status = "failed"
+		}
+		writer.Write([]string{file.Path, formatInt(file.SizeBytes), formatInt(file.WarmBytes), formatInt(file.Blocks), status})
+	}
+	writer.Write([]string{"", "", formatInt(plan.TotalBytes), formatInt(plan.TotalBlocks), "total"})
+	writer.Flush()
+	return writer.Error()
+}
+
+// fileStatus sums up the outcome of a file in a word: ok, failed, timed_out, removed, partial or mismatch
+// Files with failed blocks but read otherwise count as failed, like in the exit code
+func fileStatus(file warmer.FileStat) string {
+	switch {
+	case file.TimedOut:
+		return "timed_out"
+	case file.Removed:
+		return "removed"
+	case file.MissingBytes > 0:
+		return "partial"
+	case file.Error != "" || len(file.FailedBlocks) > 0:
+		return "failed"
+	case file.Verify == warmer.VerifyMismatch:
+		return "mismatch"
+	default:
+		return "ok"
+	}
+}
+
+func formatInt(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 3, 64)
+}
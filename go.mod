@@ -5,3 +5,19 @@ go 1.22.12
 require golang.org/x/sys v0.30.0
 
 require github.com/iceber/iouring-go v0.0.0-20230403020409-002cfd2e2a90
+
+require golang.org/x/time v0.5.0
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/prometheus/client_golang v1.19.1
+	github.com/prometheus/client_model v0.5.0 // indirect
+	github.com/prometheus/common v0.48.0 // indirect
+	github.com/prometheus/procfs v0.12.0 // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
+)
+
+require gopkg.in/yaml.v3 v3.0.1
+
+require github.com/kr/text v0.2.0 // indirect
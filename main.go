@@ -0,0 +1,804 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"file_warmer/warmer"
+)
+
+// Defaults mirror the ones used by the python wrapper
+const (
+	defaultSmallFileSizeThreshold int64 = 1024 * 1024 // 1MB
+	defaultSmallFilesWorkerCount  int   = 1
+	defaultLargeFilesWorkerCount  int   = 4
+)
+
+// Reads are I/O bound, so a couple of workers per CPU keeps the disk busy
+// Capped to avoid oversubscribing slow disks on large machines
+const maxDefaultWorkerCount int = 32
+
+// Directories read at the same time when expanding the input, stat latency dominates on network filesystems
+const defaultWalkWorkers int = 16
+
+func defaultWorkerCount() int {
+	return min(max(runtime.NumCPU()*2, defaultLargeFilesWorkerCount), maxDefaultWorkerCount)
+}
+
+// Exit codes of the CLI, a signal stopping the warmup exits with 128 plus its number
+const (
+	exitSuccess = 0
+	// Some files couldn't be opened or had blocks that failed after retrying
+	exitFailure = 1
+	// Invalid flags or arguments
+	exitUsage = 2
+	// Aborted as the throughput stayed below --min-throughput
+	exitTooSlow = 3
+)
+
+// dryRun prints the plan of the warmup, returning the exit code a warmup would have
+func dryRun(filePaths []string, opts warmer.Options, assumeRate int64, explain bool, collectErr error, formatter statsFormatter, output io.Writer, logger *warmer.Logger) int {
+	plan, err := warmer.NewPlan(filePaths, opts, assumeRate, explain)
+	err = errors.Join(collectErr, err)
+	if err := formatter.writePlan(output, logger, plan); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing plan: %v\n", err)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFailure
+	}
+	return exitSuccess
+}
+
+// stringList collects the values of a flag given multiple times
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// parseIOPriority parses idle or best-effort:N, empty leaves the priority unchanged
+func parseIOPriority(value string) (warmer.IOPriority, error) {
+	class, level, hasLevel := strings.Cut(value, ":")
+	switch {
+	case value == "":
+		return warmer.IOPriority{}, nil
+	case value == "idle":
+		return warmer.IOPriority{Class: warmer.IOPriorityIdle}, nil
+	case class == "best-effort" && hasLevel:
+		n, err := strconv.Atoi(level)
+		if err != nil || n < 0 || n > 7 {
+			return warmer.IOPriority{}, fmt.Errorf("level must be 0 to 7, got %q", level)
+		}
+		return warmer.IOPriority{Class: warmer.IOPriorityBestEffort, Level: n}, nil
+	default:
+		return warmer.IOPriority{}, errors.New("must be idle or best-effort:N")
+	}
+}
+
+func exitCode(stats warmer.Result, err error) int {
+	var sigErr signalError
+	if errors.As(err, &sigErr) {
+		return sigErr.exitCode()
+	}
+	if errors.As(err, &throughputError{}) {
+		return exitTooSlow
+	}
+	if err != nil || stats.FailedFiles > 0 {
+		return exitFailure
+	}
+	return exitSuccess
+}
+
+// main is only used when built as an executable (fwup)
+// It's ignored when built with -buildmode=c-shared
+func main() {
+	os.Exit(run())
+}
+
+// run is fwup, it returns the exit code rather than exiting so the deferred cleanups still run
+// E.g. the metrics server serving the final counters, or the output being closed
+func run() int {
+	// Subcommands have flags of their own, fwup warm is the default one
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "submit":
+			// Hands a job to a daemon
+			return runSubmit(os.Args[2:])
+		case "stat":
+			return runStat(os.Args[2:])
+		case "verify":
+			return runVerify(os.Args[2:])
+		case "warm":
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		}
+	}
+
+	// 256K is what every caller used before the flag, the Python binding still passes it, so it stays the default
+	blockSizeFlag := flag.String("block-size", "256K", "Size of each block read, e.g. 64K, 1M, 4M (must be a multiple of 512)")
+	workersFlag := flag.Int("workers", 0, "Number of workers reading blocks of large files (default: derived from CPU count)")
+	workersPerDiskFlag := flag.Int("workers-per-disk", 0, "Warm every device with its own pool of this many workers for large files, all devices at once, e.g. for a JBOD (default: one pool shared by all devices)")
+	perDiskConcurrencyFlag := flag.Int("per-disk-concurrency", 0, "With --file-concurrency, most files on the same device warmed at the same time (default: no limit)")
+	openBatchFlag := flag.Int("open-batch", 0, "Files opened at a time, so huge lists don't run into the limit of open files (default: half the soft RLIMIT_NOFILE)")
+	orderFlag := flag.String("order", string(warmer.OrderInput), "Order files are warmed in: input (as given) or size-desc (largest first)")
+	fileConcurrencyFlag := flag.Int("file-concurrency", 1, "Number of files warmed at the same time, each with its own workers")
+	recursiveFlag := flag.Bool("recursive", false, "Descend into subdirectories of directories given as input")
+	var excludes stringList
+	flag.Var(&excludes, "exclude", "Skip paths found in directories matching this glob, on the base name or the relative path, e.g. '*.tmp' or '.git/' (repeatable)")
+	walkWorkersFlag := flag.Int("walk-workers", defaultWalkWorkers, "Directories read and files stat'ed at the same time while collecting the input, 1 walks sequentially")
+	followSymlinksFlag := flag.Bool("follow-symlinks", false, "Warm the targets of symlinks in the input, they are skipped by default")
+	fromFileFlag := flag.String("from-file", "", "Read newline delimited paths to warm from this file, in addition to the arguments")
+	blocksPerReadFlag := flag.Int("blocks-per-read", 1, "Consecutive blocks read by a worker at once, psync reads them with a single preadv")
+	patternFlag := flag.String("pattern", string(warmer.PatternSequential), "Order the blocks of a file are read in: sequential or random (runs of --blocks-per-read shuffled, for random access consumers)")
+	seedFlag := flag.String("seed", "", "With --pattern=random, seed of the order, the same seed reads the files in the same order (default: picked at random and logged)")
+	strideFlag := flag.Bool("stride", false, "Give every worker its own region of a file to read, so concurrent reads are spread over the file, e.g. for HDDs or striped volumes")
+	adaptiveFlag := flag.Bool("adaptive", false, "Find the read size of every file, from one --block-size doubling while throughput improves up to 16M")
+	modeFlag := flag.String("mode", "read", "How files are warmed: read (read every block) or willneed (ask the kernel to prefetch)")
+	backendFlag := flag.String("backend", string(warmer.PosixSync), "How blocks are read with --mode=read: psync, io_uring (or iouring), readahead or mmap")
+	waitResidentFlag := flag.Bool("wait-resident", false, "With --mode=willneed, wait until the files are fully resident in page cache")
+	mmapPopulateFlag := flag.Bool("mmap-populate", false, "With --backend=mmap, also touch one byte per page so the files are fetched right away, not whenever the kernel gets to it")
+	skipCachedFlag := flag.Bool("skip-cached", false, "Only read blocks not already resident in page cache, e.g. to resume an interrupted run")
+	noDirectFlag := flag.Bool("no-direct", false, "Read through page cache instead of with O_DIRECT, so the files stay cached")
+	noDirectFallbackFlag := flag.String("no-direct-fallback", "on", "Read files through page cache when their filesystem refuses O_DIRECT (on), or fail them (off)")
+	touchOnlyFlag := flag.Bool("touch-only", false, "With --backend=psync, read just the start of every block (4K with O_DIRECT, 1 byte with --no-direct) to make the backing store fetch it")
+	evictAfterFlag := flag.Bool("evict-after", false, "Drop every range from page cache right after reading it, to fetch files into the backing store without filling page cache")
+	residencyFlag := flag.Bool("residency", false, "Measure how much of every file is in page cache before and after warming, and print the difference")
+	dispatchFlag := flag.String("dispatch", string(warmer.DispatchSequential), "How blocks of the files of a lane are handed to the workers: sequential (file after file), interleave (all files round robin) or weighted (all files, small ones first)")
+	fadviseHintFlag := flag.String("fadvise-hint", string(warmer.HintSequential), "Access pattern announced before reading through page cache: sequential, random or normal")
+	skipHolesFlag := flag.Bool("skip-holes", false, "Only read blocks holding data, skipping the holes of sparse files")
+	maxRateFlag := flag.String("max-rate", "", "Cap the combined read rate of all workers per second, e.g. 200M (default: unlimited)")
+	ioprioFlag := flag.String("ioprio", "", "I/O scheduling priority of the workers: idle or best-effort:N with N from 0 (highest) to 7 (default: unchanged)")
+	niceFlag := flag.String("nice", "", "CPU scheduling nice level of the process, from -20 (highest priority) to 19 (lowest) (default: unchanged)")
+	pinCPUsFlag := flag.Bool("pin-cpus", false, "Lock every worker to a CPU of its own, so benchmarks don't vary with workers migrating between cores (best with at least as many free CPUs as workers, Linux only)")
+	retriesFlag := flag.Int("retries", warmer.DefaultReadRetries, "Times a block failing with a transient error (EIO, ETIMEDOUT, ENOMEM) is read again, with exponential backoff")
+	fileTimeoutFlag := flag.Duration("file-timeout", 0, "Give up on a file taking longer than this, e.g. 10m, and move on to the next one (default: no limit)")
+	verifyFlag := flag.String("verify", "", "Verify the data read against the checksums given with --checksums, only sha256 is supported")
+	checksumsFlag := flag.String("checksums", "", "File with the expected checksums for --verify, in the format written by sha256sum")
+	manifestFlag := flag.String("manifest", "", "JSON manifest of the files to warm, each with an optional offset, length and sha256 of those bytes to verify")
+	continueOnErrorFlag := flag.Bool("continue-on-error", false, "With --manifest, still warm the other entries when some files of the manifest don't exist")
+	fileStatsFlag := flag.Bool("file-stats", false, "Also log time and throughput of every file")
+	jsonFlag := flag.Bool("json", false, "Print the stats as a single JSON object on stdout, same as --format=json")
+	formatFlag := flag.String("format", "text", "Format of the stats: text (logged), json or csv (on stdout, logs go to stderr)")
+	progressFlag := flag.Bool("progress", false, "Show a live progress bar on stderr, or log progress periodically when it's not a terminal")
+	sampleIntervalFlag := flag.Duration("sample-interval", 0, "Log the throughput over the last interval and since the start this often, e.g. 5s (default: off)")
+	sampleSocketFlag := flag.String("sample-socket", "", "With --sample-interval, write the samples as JSON lines to this Unix socket instead of logging them")
+	minThroughputFlag := flag.Float64("min-throughput", 0, "Abort with exit code 3 once the throughput stayed below this many MB/s for --min-throughput-window (default: off)")
+	minThroughputGraceFlag := flag.Duration("min-throughput-grace", 30*time.Second, "With --min-throughput, time after the start before throughput is checked")
+	minThroughputWindowFlag := flag.Duration("min-throughput-window", time.Minute, "With --min-throughput, how long the throughput has to stay below it to abort")
+	metricsAddrFlag := flag.String("metrics-addr", "", "Serve Prometheus metrics on this address while warming, e.g. :9100")
+	strictFlag := flag.Bool("strict", false, "Stop at the first file that can't be found or warmed, by default the other files are still warmed")
+	repeatFlag := flag.Int("repeat", 1, "Warm the files this many times, dropping them from page cache in between, and report the throughput of every run")
+	outputFlag := flag.String("output", "", "Write the stats to this file in the --format, or to stdout with -, logs then go to stderr (default: stdout, text stats along with the logs)")
+	reportFlag := flag.String("report", "", "Also write the final stats to this file in the --format, creating parent directories as needed")
+	writeFailuresFlag := flag.String("write-failures", "", "Write the paths of the files that failed to this file on exit, one per line, to retry them with --from-file")
+	physicalOrderFlag := flag.Bool("physical-order", false, "Read the blocks of a file in the order they lie on disk (FIEMAP), saves seeks on fragmented files on HDDs")
+	headFlag := flag.String("head", "", "Only warm the first bytes of every file, e.g. 1M, files given with a byte range keep it (default: whole files)")
+	tailFlag := flag.String("tail", "", "Only warm the last bytes of every file, e.g. 1M for footers and indexes, with --head both ends and not the middle (default: whole files)")
+	histogramFlag := flag.Bool("histogram", false, "Record the latency of every read and print p50/p90/p99/max per file and overall")
+	dryRunFlag := flag.Bool("dry-run", false, "Only print how many files, bytes and blocks would be warmed, nothing is read")
+	explainFlag := flag.Bool("explain", false, "Dry run also printing the block size, workers and order of the blocks of every file, nothing is read")
+	excludeSmallerFlag := flag.String("exclude-smaller-than", "", "Skip files smaller than this, e.g. 1M, they are cheap to fault in on demand (default: no minimum)")
+	excludeLargerFlag := flag.String("exclude-larger-than", "", "Skip files larger than this, e.g. 10G (default: no maximum)")
+	maxMemoryFlag := flag.String("max-memory", "", "Cap of the buffer memory of all workers, e.g. 512M, fewer workers are used to fit (default: unlimited)")
+	assumeRateFlag := flag.String("assume-rate", "500M", "Throughput per second the --dry-run time estimate assumes, --max-rate caps it")
+	verboseFlag := flag.Bool("verbose", false, "Also log debug messages, e.g. retried reads")
+	quietFlag := flag.Bool("quiet", false, "Only log errors")
+	maxFileErrorsFlag := flag.Int("max-file-errors", 0, "Give up on a file after this many of its blocks failed in a row, e.g. on a dead mount (default: try all blocks)")
+	daemonFlag := flag.Bool("daemon", false, "Keep running and warm the jobs queued with fwup submit over --socket, the other flags are the defaults of the jobs")
+	socketFlag := flag.String("socket", defaultSocketPath, "Unix socket the --daemon listens on")
+	var watchDirs stringList
+	flag.Var(&watchDirs, "watch", "Keep running and warm every file written and closed or moved into this directory, its subdirectories too with --recursive (repeatable)")
+	configFlag := flag.String("config", "", "YAML file with defaults for the flags, keyed by flag name and optionally grouped in sections, paths lists the inputs (flags and the environment take precedence)")
+	versionFlag := flag.Bool("version", false, "Print the version, commit and build date, then exit")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [warm] [flags] path...\n       %s stat|verify|submit [flags] ...\n\n", os.Args[0], os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Warms the given files, directories are walked for the files in them. A single - reads the paths from stdin.")
+		fmt.Fprintln(flag.CommandLine.Output(), "\nFlags:")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *versionFlag {
+		printVersion(os.Stdout)
+		return exitSuccess
+	}
+	if err := loadConfig(flag.CommandLine, os.Getenv); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+	// Paths given as arguments replace the ones of the config file
+	inputArgs := flag.Args()
+	if *configFlag != "" {
+		configPaths, err := loadConfigFile(flag.CommandLine, *configFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --config: %v\n", err)
+			return exitUsage
+		}
+		if len(inputArgs) == 0 {
+			inputArgs = configPaths
+		}
+	}
+
+	if *verboseFlag && *quietFlag {
+		fmt.Fprintln(os.Stderr, "Invalid flags: --verbose and --quiet can't be used together")
+		return exitUsage
+	}
+	var level = warmer.LevelInfo
+	if *verboseFlag {
+		level = warmer.LevelDebug
+	} else if *quietFlag {
+		level = warmer.LevelError
+	}
+
+	if *jsonFlag {
+		if *formatFlag != "text" && *formatFlag != "json" {
+			fmt.Fprintf(os.Stderr, "Invalid flags: --json can't be combined with --format=%s\n", *formatFlag)
+			return exitUsage
+		}
+		*formatFlag = "json"
+	}
+	formatter, ok := formatters[*formatFlag]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Invalid --format %q: must be text, json or csv\n", *formatFlag)
+		return exitUsage
+	}
+	if jsonOutput, ok := formatter.(jsonFormatter); ok && *writeFailuresFlag != "" {
+		jsonOutput.failuresPath = *writeFailuresFlag
+		formatter = jsonOutput
+	}
+
+	// Keep stdout clean for the machine readable output, or the stats sent to it with --output
+	var logOutput io.Writer = os.Stdout
+	if *formatFlag != "text" || *outputFlag != "" {
+		logOutput = os.Stderr
+	}
+	var logger = warmer.NewLogger(logOutput, level)
+
+	blockSize, err := parseSize(*blockSizeFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --block-size %q: %v\n", *blockSizeFlag, err)
+		return exitUsage
+	}
+
+	var maxRate int64
+	if *maxRateFlag != "" {
+		maxRate, err = parseSize(*maxRateFlag)
+		if err == nil && maxRate <= 0 {
+			err = errors.New("must be positive")
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --max-rate %q: %v\n", *maxRateFlag, err)
+			return exitUsage
+		}
+	}
+
+	assumeRate, err := parseSize(*assumeRateFlag)
+	if err == nil && assumeRate <= 0 {
+		err = errors.New("must be positive")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --assume-rate %q: %v\n", *assumeRateFlag, err)
+		return exitUsage
+	}
+	if maxRate > 0 {
+		assumeRate = min(assumeRate, maxRate)
+	}
+	var maxMemory int64
+	maxMemoryDetected := false
+	if *maxMemoryFlag != "" {
+		maxMemory, err = parseSize(*maxMemoryFlag)
+		if err == nil && maxMemory <= 0 {
+			err = errors.New("must be positive")
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --max-memory %q: %v\n", *maxMemoryFlag, err)
+			return exitUsage
+		}
+	}
+
+	if *noDirectFallbackFlag != "on" && *noDirectFallbackFlag != "off" {
+		fmt.Fprintf(os.Stderr, "Invalid --no-direct-fallback %q: must be on or off\n", *noDirectFallbackFlag)
+		return exitUsage
+	}
+
+	var minSize, maxSize int64
+	if *excludeSmallerFlag != "" {
+		minSize, err = parseSize(*excludeSmallerFlag)
+		if err == nil && minSize <= 0 {
+			err = errors.New("must be positive")
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --exclude-smaller-than %q: %v\n", *excludeSmallerFlag, err)
+			return exitUsage
+		}
+	}
+	if *excludeLargerFlag != "" {
+		maxSize, err = parseSize(*excludeLargerFlag)
+		if err == nil && maxSize <= 0 {
+			err = errors.New("must be positive")
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --exclude-larger-than %q: %v\n", *excludeLargerFlag, err)
+			return exitUsage
+		}
+	}
+	if maxSize > 0 && minSize > maxSize {
+		fmt.Fprintln(os.Stderr, "Invalid flags: --exclude-smaller-than is above --exclude-larger-than, no file would be warmed")
+		return exitUsage
+	}
+
+	var method warmer.FileIOMethod
+	switch *modeFlag {
+	case "read":
+		method = warmer.FileIOMethod(*backendFlag)
+		if *backendFlag == "iouring" {
+			method = warmer.IOUring
+		}
+		// Backends registered by programs embedding the warmer can be picked too
+		var backends []string
+		for _, backend := range warmer.Methods() {
+			if backend != warmer.WillNeed {
+				backends = append(backends, string(backend))
+			}
+		}
+		if !slices.Contains(backends, string(method)) {
+			fmt.Fprintf(os.Stderr, "Invalid --backend %q: must be one of %s\n", *backendFlag, strings.Join(backends, ", "))
+			return exitUsage
+		}
+	case "willneed":
+		method = warmer.WillNeed
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid --mode %q: must be read or willneed\n", *modeFlag)
+		return exitUsage
+	}
+
+	workers := *workersFlag
+	if workers == 0 {
+		workers = defaultWorkerCount()
+	}
+
+	var checksums map[string][]byte
+	switch {
+	case *verifyFlag == "" && *checksumsFlag != "":
+		fmt.Fprintln(os.Stderr, "Invalid flags: --checksums needs --verify=sha256")
+		return exitUsage
+	case *verifyFlag == "":
+	case *verifyFlag != "sha256":
+		fmt.Fprintf(os.Stderr, "Invalid --verify %q: only sha256 is supported\n", *verifyFlag)
+		return exitUsage
+	case *checksumsFlag == "":
+		fmt.Fprintln(os.Stderr, "Invalid flags: --verify needs --checksums with the expected checksums")
+		return exitUsage
+	default:
+		checksums, err = warmer.ReadChecksums(*checksumsFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading --checksums: %v\n", err)
+			return exitFailure
+		}
+	}
+
+	if err := validateExcludes(excludes); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --exclude %v\n", err)
+		return exitUsage
+	}
+
+	if *walkWorkersFlag < 1 {
+		fmt.Fprintf(os.Stderr, "Invalid --walk-workers %d: need at least 1\n", *walkWorkersFlag)
+		return exitUsage
+	}
+	// In a container the memory of the machine isn't what the OOM killer goes by, the limit of the cgroup is
+	if *maxMemoryFlag == "" && *workersPerDiskFlag == 0 {
+		limit, err := cgroupMemoryLimit()
+		if err != nil {
+			logger.Warnf("Error reading the cgroup memory limit, buffers aren't capped: %v\n", err)
+		}
+		if limit > 0 {
+			maxMemory = limit / cgroupMemoryShare
+			maxMemoryDetected = true
+			logger.Infof("Detected a cgroup memory limit of %d bytes, capping buffers at %d bytes\n", limit, maxMemory)
+		}
+	}
+	ioPriority, err := parseIOPriority(*ioprioFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --ioprio %q: %v\n", *ioprioFlag, err)
+		return exitUsage
+	}
+	if *niceFlag != "" {
+		level, err := strconv.Atoi(*niceFlag)
+		if err != nil || level < -20 || level > 19 {
+			fmt.Fprintf(os.Stderr, "Invalid --nice %q: must be -20 to 19\n", *niceFlag)
+			return exitUsage
+		}
+		// Raising the priority takes CAP_SYS_NICE or a RLIMIT_NICE allowing it, warming goes on without it
+		if err := setNice(level); errors.Is(err, os.ErrPermission) {
+			logger.Warnf("Not allowed to lower the nice level to %d, keeping the current one: %v\n", level, err)
+		} else if err != nil {
+			logger.Warnf("Error setting the nice level to %d: %v\n", level, err)
+		}
+	}
+	seed := time.Now().UnixNano()
+	if *seedFlag != "" {
+		seed, err = strconv.ParseInt(*seedFlag, 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --seed %q: must be an integer\n", *seedFlag)
+			return exitUsage
+		}
+		if warmer.ReadPattern(*patternFlag) != warmer.PatternRandom {
+			fmt.Fprintln(os.Stderr, "Invalid flags: --seed only applies to --pattern=random")
+			return exitUsage
+		}
+	}
+	if *repeatFlag < 1 {
+		fmt.Fprintf(os.Stderr, "Invalid --repeat %d: must be at least 1\n", *repeatFlag)
+		return exitUsage
+	}
+	if *sampleIntervalFlag < 0 {
+		fmt.Fprintf(os.Stderr, "Invalid --sample-interval %v: must not be negative\n", *sampleIntervalFlag)
+		return exitUsage
+	}
+	if *minThroughputFlag < 0 {
+		fmt.Fprintf(os.Stderr, "Invalid --min-throughput %v: must not be negative\n", *minThroughputFlag)
+		return exitUsage
+	}
+	if *minThroughputGraceFlag < 0 {
+		fmt.Fprintf(os.Stderr, "Invalid --min-throughput-grace %v: must not be negative\n", *minThroughputGraceFlag)
+		return exitUsage
+	}
+	if *minThroughputWindowFlag <= 0 {
+		fmt.Fprintf(os.Stderr, "Invalid --min-throughput-window %v: must be positive\n", *minThroughputWindowFlag)
+		return exitUsage
+	}
+	if *sampleSocketFlag != "" && *sampleIntervalFlag == 0 {
+		fmt.Fprintln(os.Stderr, "Invalid flags: --sample-socket needs --sample-interval")
+		return exitUsage
+	}
+
+	if *daemonFlag && len(inputArgs) > 0 {
+		fmt.Fprintln(os.Stderr, "Invalid arguments: --daemon takes its paths from the jobs submitted to it")
+		return exitUsage
+	}
+	if len(watchDirs) > 0 && (len(inputArgs) > 0 || *daemonFlag) {
+		fmt.Fprintln(os.Stderr, "Invalid arguments: --watch only warms the files appearing in the watched directories")
+		return exitUsage
+	}
+	// Stdin can only be read once, the second reader would get no paths
+	if *fromFileFlag == "-" && slices.Contains(inputArgs, "-") {
+		fmt.Fprintln(os.Stderr, "Invalid arguments: - and --from-file - both read the paths from stdin, give only one of them")
+		return exitUsage
+	}
+
+	if *manifestFlag != "" && checksums != nil {
+		fmt.Fprintln(os.Stderr, "Invalid flags: --manifest brings its own checksums, it can't be combined with --verify")
+		return exitUsage
+	}
+	// O_DIRECT reads leave page cache as it was, there'd be nothing to see
+	if *residencyFlag && method != warmer.ReadAhead && method != warmer.Mmap && method != warmer.WillNeed && !*noDirectFlag {
+		fmt.Fprintln(os.Stderr, "Invalid flags: --residency needs reads populating page cache, use --mode=willneed, --backend=readahead or mmap, or --no-direct")
+		return exitUsage
+	}
+	var head int64
+	if *headFlag != "" {
+		head, err = parseSize(*headFlag)
+		if err == nil && head <= 0 {
+			err = errors.New("must be positive")
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --head %q: %v\n", *headFlag, err)
+			return exitUsage
+		}
+	}
+	var tail int64
+	if *tailFlag != "" {
+		tail, err = parseSize(*tailFlag)
+		if err == nil && tail <= 0 {
+			err = errors.New("must be positive")
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --tail %q: %v\n", *tailFlag, err)
+			return exitUsage
+		}
+	}
+
+	opts := warmer.Options{
+		Method:                 method,
+		SmallFileSizeThreshold: defaultSmallFileSizeThreshold,
+		BlockSizeForSmallFiles: blockSize,
+		BlockSizeForLargeFiles: blockSize,
+		SmallFilesWorkerCount:  defaultSmallFilesWorkerCount,
+		LargeFilesWorkerCount:  workers,
+		Order:                  warmer.FileOrder(*orderFlag),
+		Dispatch:               warmer.DispatchMode(*dispatchFlag),
+		OpenBatch:              *openBatchFlag,
+		Strict:                 *strictFlag,
+		FileConcurrency:        *fileConcurrencyFlag,
+		PerDiskConcurrency:     *perDiskConcurrencyFlag,
+		WorkersPerDisk:         *workersPerDiskFlag,
+		BlocksPerRead:          *blocksPerReadFlag,
+		Adaptive:               *adaptiveFlag,
+		Stride:                 *strideFlag,
+		Pattern:                warmer.ReadPattern(*patternFlag),
+		Seed:                   seed,
+		WaitResident:           *waitResidentFlag,
+		MmapPopulate:           *mmapPopulateFlag,
+		SkipCached:             *skipCachedFlag,
+		SkipHoles:              *skipHolesFlag,
+		NoDirect:               *noDirectFlag,
+		DirectOnly:             *noDirectFallbackFlag == "off",
+		EvictAfter:             *evictAfterFlag,
+		TouchOnly:              *touchOnlyFlag,
+		FadviseHint:            warmer.FadviseHint(*fadviseHintFlag),
+		MaxRate:                maxRate,
+		MaxMemory:              maxMemory,
+		MaxMemoryBestEffort:    maxMemoryDetected,
+		Histogram:              *histogramFlag,
+		Head:                   head,
+		Tail:                   tail,
+		PhysicalOrder:          *physicalOrderFlag,
+		Checksums:              checksums,
+		Retries:                *retriesFlag,
+		IOPriority:             ioPriority,
+		PinCPUs:                *pinCPUsFlag,
+		FileTimeout:            *fileTimeoutFlag,
+		MaxFileErrors:          *maxFileErrorsFlag,
+		Logger:                 logger,
+	}
+	// The combinations of flags the warmer can't do are checked by the warmer, in one place
+	// Checked before the input is walked, an invalid combination shouldn't wait for a huge tree
+	// Ranges and the checksums of a manifest only come with the paths, the options are checked again with them
+	if err := opts.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid flags: %v\n", err)
+		return exitUsage
+	}
+	if opts.Pattern == warmer.PatternRandom {
+		logger.Infof("Reading blocks in random order, seed %d\n", seed)
+	}
+
+	// A single "-" argument reads the paths from stdin, e.g. find ... | fwup -
+	var args []string
+	readStdin := false
+	for _, arg := range inputArgs {
+		if arg == "-" {
+			readStdin = true
+			continue
+		}
+		args = append(args, arg)
+	}
+
+	// Ranges are stripped before globs are expanded, a pattern can't carry one
+	ranges := make(map[string]warmer.ByteRange)
+	args, err = splitRanges(args, ranges)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid argument: %v\n", err)
+		return exitUsage
+	}
+	paths := expandGlobs(args, logger)
+	if *fromFileFlag != "" {
+		listedPaths, err := readPathsFile(*fromFileFlag)
+		if err == nil {
+			listedPaths, err = splitRanges(listedPaths, ranges)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading --from-file: %v\n", err)
+			return exitFailure
+		}
+		paths = append(paths, listedPaths...)
+	}
+	if readStdin {
+		listedPaths, err := readPathList(os.Stdin)
+		if err == nil {
+			listedPaths, err = splitRanges(listedPaths, ranges)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading paths from stdin: %v\n", err)
+			return exitFailure
+		}
+		paths = append(paths, listedPaths...)
+	}
+	// A manifest is a data set, by default it's only warmed with every file of it there
+	var entries []manifestEntry
+	var manifestChecksums map[string][]byte
+	if *manifestFlag != "" {
+		entries, err = readManifest(*manifestFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading --manifest: %v\n", err)
+			return exitFailure
+		}
+		if err := missingEntries(entries); err != nil {
+			if !*continueOnErrorFlag {
+				fmt.Fprintf(os.Stderr, "Error: files of the manifest are missing, warm the others with --continue-on-error: %v\n", err)
+				return exitFailure
+			}
+			logger.Warnf("Files of the manifest are missing: %v\n", err)
+		}
+		paths, manifestChecksums = addManifest(entries, paths, ranges, manifestChecksums)
+	}
+	// Paths that can't be warmed still fail the run, the other paths are warmed anyway
+	filePaths, collectErr := collectFilePaths(paths, *recursiveFlag, *followSymlinksFlag, excludes, *walkWorkersFlag, logger)
+	if *strictFlag && collectErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", collectErr)
+		return exitFailure
+	}
+	filePaths = filterBySize(filePaths, minSize, maxSize, *walkWorkersFlag, logger)
+	warnUnusedRanges(ranges, filePaths, logger)
+	// Ranges of a manifest come with the checksums of those bytes, the ones of --checksums are of whole files
+	if len(ranges) > 0 && checksums != nil {
+		fmt.Fprintln(os.Stderr, "Invalid flags: --verify checks whole files, it can't be combined with byte ranges")
+		return exitUsage
+	}
+	if manifestChecksums != nil {
+		checksums = manifestChecksums
+	}
+	opts.Checksums, opts.Ranges = checksums, ranges
+	if err := opts.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid flags: %v\n", err)
+		return exitUsage
+	}
+
+	if *daemonFlag {
+		ctx, stop := notifySignals(context.Background())
+		defer stop()
+		return runDaemon(ctx, *socketFlag, opts, logger)
+	}
+	if len(watchDirs) > 0 {
+		ctx, stop := notifySignals(context.Background())
+		defer stop()
+		return runWatch(ctx, watchDirs, *recursiveFlag, opts, logger)
+	}
+
+	// Text stats are logged, to the output instead of along with the logs once it's given
+	var output io.Writer = os.Stdout
+	outputLogger := logger
+	if *outputFlag != "" {
+		if *outputFlag != "-" {
+			outputFile, err := createReport(*outputFlag)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error creating --output: %v\n", err)
+				return exitFailure
+			}
+			defer outputFile.Close()
+			output = outputFile
+		}
+		outputLogger = warmer.NewLogger(output, warmer.LevelInfo)
+	}
+
+	if *dryRunFlag || *explainFlag {
+		return dryRun(filePaths, opts, assumeRate, *explainFlag, collectErr, formatter, output, outputLogger)
+	}
+
+	// Created up front, a path that isn't writable shouldn't only show up after the warmup
+	var reportFile *os.File
+	if *reportFlag != "" {
+		reportFile, err = createReport(*reportFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating --report: %v\n", err)
+			return exitFailure
+		}
+	}
+	var failuresFile *os.File
+	if *writeFailuresFlag != "" {
+		failuresFile, err = createReport(*writeFailuresFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating --write-failures: %v\n", err)
+			return exitFailure
+		}
+	}
+
+	// Ctrl-C stops the warmup, stats of what was done so far are still logged
+	ctx, stop := notifySignals(context.Background())
+	defer stop()
+
+	counters := &warmer.Counters{}
+	opts.Counters = counters
+	stopProgressDumps := notifyProgressDumps(counters)
+	defer stopProgressDumps()
+	var sampler *throughputSampler
+	if *sampleIntervalFlag > 0 || *minThroughputFlag > 0 {
+		interval := *sampleIntervalFlag
+		if interval == 0 {
+			interval = throughputGuardInterval
+		}
+		sampler, err = newThroughputSampler(interval, *sampleSocketFlag, counters, logger)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error connecting to --sample-socket: %v\n", err)
+			return exitFailure
+		}
+		sampler.quiet = *sampleIntervalFlag == 0
+		if *minThroughputFlag > 0 {
+			var abort context.CancelCauseFunc
+			ctx, abort = context.WithCancelCause(ctx)
+			defer abort(nil)
+			sampler.guard = &throughputGuard{minMBs: *minThroughputFlag, grace: *minThroughputGraceFlag, window: *minThroughputWindowFlag, abort: abort}
+		}
+		sampler.start()
+		defer sampler.close()
+	}
+	if *metricsAddrFlag != "" {
+		stopMetrics, err := startMetricsServer(*metricsAddrFlag, counters, sampler, logger)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error starting metrics server: %v\n", err)
+			return exitFailure
+		}
+		defer stopMetrics()
+	}
+	var progressDone <-chan struct{}
+	stopProgress := func() {}
+	if *progressFlag {
+		var progressCtx context.Context
+		progressCtx, stopProgress = context.WithCancel(context.Background())
+		progressDone = showProgress(progressCtx, counters, logger)
+	}
+
+	// Repeated runs all start cold, a previous one may have left the files in page cache
+	var runs []warmer.Result
+	var residencyBefore []warmer.FileResidency
+	err = collectErr
+	for run := 1; run <= *repeatFlag && (run == 1 || ctx.Err() == nil); run++ {
+		if *repeatFlag > 1 {
+			if err := warmer.Evict(filePaths); err != nil {
+				logger.Warnf("Error dropping files from page cache before run %d: %v\n", run, err)
+			}
+		}
+		if *residencyFlag {
+			residencyBefore = measureResidency(filePaths, logger)
+		}
+		stats, runErr := warmer.Warm(ctx, filePaths, opts)
+		runs = append(runs, stats)
+		err = errors.Join(err, runErr)
+		if *repeatFlag > 1 {
+			logger.Infof("Run %d of %d: %.2f MB/s\n", run, *repeatFlag, stats.ThroughputMBs)
+		}
+	}
+	stats := runs[len(runs)-1]
+	// The final progress line goes out before the stats
+	stopProgress()
+	if progressDone != nil {
+		<-progressDone
+	}
+	// Written before the stats, the JSON output points to it
+	if failuresFile != nil {
+		failuresErr := writeFailures(failuresFile, stats, opts.Ranges)
+		if err := failuresFile.Close(); failuresErr == nil {
+			failuresErr = err
+		}
+		if failuresErr != nil {
+			err = errors.Join(err, fmt.Errorf("writing --write-failures: %w", failuresErr))
+		} else if len(stats.Failures) > 0 {
+			logger.Infof("Wrote the %d failed files to %s\n", len(stats.Failures), *writeFailuresFlag)
+		}
+	}
+	if err := formatter.writeStats(output, outputLogger, runs, *fileStatsFlag); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing stats: %v\n", err)
+	}
+	if reportFile != nil {
+		reportErr := formatter.writeStats(reportFile, warmer.NewLogger(reportFile, warmer.LevelInfo), runs, *fileStatsFlag)
+		if err := reportFile.Close(); reportErr == nil {
+			reportErr = err
+		}
+		if reportErr != nil {
+			err = errors.Join(err, fmt.Errorf("writing --report: %w", reportErr))
+		}
+	}
+	if *residencyFlag {
+		logResidency(logger, residencyBefore, measureResidency(filePaths, logger))
+	}
+	if entries != nil {
+		logManifestReport(logger, entries, stats)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	return exitCode(stats, err)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"file_warmer/warmer"
+)
+
+// manifest lists the files of a data set to warm, see readManifest
+type manifest struct {
+	Files []manifestEntry `json:"files"`
+}
+
+// manifestEntry is a file of a manifest, or the part of it from offset with length bytes
+// A length of 0 means up to the end of file, sha256 is the checksum of the bytes warmed
+type manifestEntry struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset,omitempty"`
+	Length int64  `json:"length,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// readManifest parses a JSON manifest, relative paths are relative to the directory of the manifest
+// Paths of the entries are returned cleaned, like the keys of ranges and checksums
+func readManifest(name string) ([]manifestEntry, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	seen := make(map[string]bool)
+	for i := range m.Files {
+		entry := &m.Files[i]
+		if entry.Path == "" {
+			return nil, fmt.Errorf("%s: entry %d has no path", name, i+1)
+		}
+		if !filepath.IsAbs(entry.Path) {
+			entry.Path = filepath.Join(filepath.Dir(name), entry.Path)
+		}
+		entry.Path = filepath.Clean(entry.Path)
+		if seen[entry.Path] {
+			return nil, fmt.Errorf("%s: %s is listed twice", name, entry.Path)
+		}
+		seen[entry.Path] = true
+		if entry.Offset < 0 || entry.Length < 0 {
+			return nil, fmt.Errorf("%s: invalid range of %s: offset %d, length %d", name, entry.Path, entry.Offset, entry.Length)
+		}
+		if entry.SHA256 != "" {
+			sum, err := hex.DecodeString(entry.SHA256)
+			if err != nil || len(sum) != sha256.Size {
+				return nil, fmt.Errorf("%s: invalid sha256 digest %q of %s", name, entry.SHA256, entry.Path)
+			}
+		}
+	}
+	return m.Files, nil
+}
+
+// missingEntries returns the entries whose file doesn't exist, joined into a single error
+func missingEntries(entries []manifestEntry) error {
+	var errs []error
+	for _, entry := range entries {
+		if _, err := os.Stat(entry.Path); errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// addManifest adds the entries to the inputs of the warmup, checksums is created once an entry has one
+func addManifest(entries []manifestEntry, paths []string, ranges map[string]warmer.ByteRange, checksums map[string][]byte) ([]string, map[string][]byte) {
+	for _, entry := range entries {
+		paths = append(paths, entry.Path)
+		if entry.Offset > 0 || entry.Length > 0 {
+			ranges[entry.Path] = warmer.ByteRange{Offset: entry.Offset, Length: entry.Length}
+		}
+		if entry.SHA256 != "" {
+			if checksums == nil {
+				checksums = make(map[string][]byte)
+			}
+			// Validated by readManifest
+			checksums[entry.Path], _ = hex.DecodeString(entry.SHA256)
+		}
+	}
+	return paths, checksums
+}
+
+// logManifestReport tells for every entry of the manifest if it was warmed, and verified when it had a checksum
+func logManifestReport(logger *warmer.Logger, entries []manifestEntry, stats warmer.Result) {
+	files := make(map[string]warmer.FileStat, len(stats.Files))
+	for _, file := range stats.Files {
+		files[filepath.Clean(file.Path)] = file
+	}
+
+	passed := 0
+	for _, entry := range entries {
+		file, ok := files[entry.Path]
+		switch {
+		case !ok:
+			logger.Errorf("FAIL %s: not warmed\n", entry.Path)
+		case file.Error != "":
+			logger.Errorf("FAIL %s: %s\n", entry.Path, file.Error)
+		case entry.SHA256 != "" && file.Verify != warmer.VerifyOK:
+			logger.Errorf("FAIL %s: checksum %s\n", entry.Path, file.Verify)
+		default:
+			passed++
+			logger.Infof("PASS %s\n", entry.Path)
+		}
+	}
+	logger.Infof("Manifest entries passed: %d of %d\n", passed, len(entries))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"file_warmer/warmer"
+)
+
+// Time given to running scrapes once the warmup is done
+const metricsShutdownTimeout = 5 * time.Second
+
+// newMetricsRegistry exposes the warmup counters as Prometheus metrics
+// The metrics read the atomics when scraped, workers don't need to know about them
+// With a sampler, the throughput of its last sample is exposed too
+func newMetricsRegistry(counters *warmer.Counters, startTime time.Time, sampler *throughputSampler) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "fwup_bytes_warmed_total",
+			Help: "Bytes read into the cache so far.",
+		}, func() float64 {
+			return float64(counters.BytesRead.Load())
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "fwup_files_total",
+			Help: "Files done warming, including the ones that failed.",
+		}, func() float64 {
+			return float64(counters.FilesDone.Load())
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "fwup_read_errors_total",
+			Help: "Blocks that couldn't be read after retrying.",
+		}, func() float64 {
+			return float64(counters.BlocksFailed.Load())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "fwup_throughput_bytes_per_second",
+			Help: "Average read throughput since the warmup started.",
+		}, func() float64 {
+			elapsed := time.Since(startTime).Seconds()
+			if elapsed <= 0 {
+				return 0
+			}
+			return float64(counters.BytesRead.Load()) / elapsed
+		}),
+	)
+	if sampler != nil {
+		registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "fwup_sample_throughput_bytes_per_second",
+			Help: "Read throughput over the last sample interval.",
+		}, sampler.lastRate))
+	}
+	return registry
+}
+
+// startMetricsServer serves /metrics on addr until the returned function is called
+// Listening happens right away, so a bad or busy address is reported before warming starts
+func startMetricsServer(addr string, counters *warmer.Counters, sampler *throughputSampler, logger *warmer.Logger) (func(), error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(newMetricsRegistry(counters, time.Now(), sampler), promhttp.HandlerOpts{}))
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	logger.Infof("Serving metrics on http://%s/metrics\n", listener.Addr())
+	go func() {
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("Error serving metrics: %v\n", err)
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Warnf("Error shutting down metrics server: %v\n", err)
+		}
+	}, nil
+}
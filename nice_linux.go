@@ -0,0 +1,40 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// setNice sets the nice level of every thread of the process, Linux keeps one per thread rather than per process
+// Threads started meanwhile may still have the old level, so it goes over them again until no new one shows up
+// https://man7.org/linux/man-pages/man2/setpriority.2.html
+func setNice(level int) error {
+	done := make(map[int]bool)
+	for {
+		tasks, err := os.ReadDir("/proc/self/task")
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, task := range tasks {
+			tid, err := strconv.Atoi(task.Name())
+			if err != nil || done[tid] {
+				continue
+			}
+			found = true
+			// A thread may exit before its turn
+			if err := unix.Setpriority(unix.PRIO_PROCESS, tid, level); err != nil && !errors.Is(err, unix.ESRCH) {
+				return err
+			}
+			done[tid] = true
+		}
+		if !found {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func setNice(level int) error {
+	return errors.New("setting the nice level is only supported on Linux")
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"file_warmer/warmer"
+)
+
+// collectFilePaths expands directories in the input into the regular files they contain
+// Without recursive only the top-level files of a directory are picked up
+// Symlinks are skipped unless followSymlinks is set, broken ones are returned as errors
+// Paths found in directories matching one of excludes are skipped, see isExcluded
+// Other paths are passed through as is, opening them will report any error
+// Directories are read by a pool of workers goroutines, the files still come out in the order of a sequential walk
+func collectFilePaths(paths []string, recursive bool, followSymlinks bool, excludes []string, workers int, logger *warmer.Logger) ([]string, error) {
+	collector := &pathCollector{
+		recursive:      recursive,
+		followSymlinks: followSymlinks,
+		excludes:       excludes,
+		logger:         logger,
+		visited:        make(map[string]bool),
+	}
+	collector.cond = sync.NewCond(&collector.mu)
+	collector.start(max(workers, 1))
+	defer collector.stop()
+	for _, path := range paths {
+		info, err := os.Lstat(path)
+		if err != nil {
+			collector.filePaths = append(collector.filePaths, path)
+			continue
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			info, err = collector.resolveSymlink(path)
+			if err != nil {
+				collector.errs = append(collector.errs, err)
+			}
+			if info == nil {
+				continue
+			}
+		}
+
+		if info.IsDir() {
+			collector.walkDirectory(path, nil)
+		} else {
+			collector.filePaths = append(collector.filePaths, path)
+		}
+	}
+	if len(excludes) > 0 {
+		logger.Debugf("Excluded %d paths\n", collector.excluded.Load())
+	}
+	return collector.filePaths, errors.Join(collector.errs...)
+}
+
+// Directories read ahead of the walk taking them at most, so a huge tree isn't held in memory all at once
+const maxReadAheadDirs = 256
+
+type pathCollector struct {
+	recursive      bool
+	followSymlinks bool
+	excludes       []string
+	excluded       atomic.Int64
+	logger         *warmer.Logger
+	// Directories waiting to be read by the workers, the one first in walk order is read next
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending dirQueue
+	// Directories read but not taken yet, and the one the walk waits for, which is read even past maxReadAheadDirs
+	readAhead int
+	waiting   *dirNode
+	stopped   bool
+	wg        sync.WaitGroup
+	// Real paths of the directories walked so far, a symlink back to one of them would loop forever
+	visited   map[string]bool
+	filePaths []string
+	errs      []error
+}
+
+// dirNode is a directory read by a walk, with its entries in the order WalkDir would visit them
+type dirNode struct {
+	path string
+	// Excludes match paths relative to the directory the walk started at
+	root string
+	// Indexes of the entries leading to the directory from the top, ordering directories like a sequential walk
+	order   []int
+	entries []dirEntry
+	// Closed once the entries are read
+	ready chan struct{}
+}
+
+func newDirNode(path string, root string, order []int) *dirNode {
+	return &dirNode{path: path, root: root, order: order, ready: make(chan struct{})}
+}
+
+// dirEntry is what a walk found in a directory, one of the fields is set
+type dirEntry struct {
+	file string
+	// A subdirectory, read in the same walk
+	dir *dirNode
+	// A symlink to a directory, walked on its own once the walk gets to it
+	target string
+	err    error
+}
+
+// dirQueue is a heap of directories to read, ordered by their position in the walk
+type dirQueue []*dirNode
+
+func (q dirQueue) Len() int           { return len(q) }
+func (q dirQueue) Less(i, j int) bool { return slices.Compare(q[i].order, q[j].order) < 0 }
+func (q dirQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *dirQueue) Push(x any)        { *q = append(*q, x.(*dirNode)) }
+func (q *dirQueue) Pop() any {
+	old := *q
+	node := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return node
+}
+
+// resolveSymlink returns what the link points to, nil if it shouldn't be followed at all
+// A broken link is returned as error
+func (c *pathCollector) resolveSymlink(path string) (fs.FileInfo, error) {
+	if !c.followSymlinks {
+		c.logger.Warnf("Skipping symlink %s, use --follow-symlinks to warm its target\n", path)
+		return nil, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		c.logger.Errorf("Broken symlink %s: %v\n", path, err)
+		return nil, fmt.Errorf("broken symlink %s: %w", path, err)
+	}
+	return info, nil
+}
+
+// gzipMagic starts every gzip stream, a list is told compressed by its content rather than its name
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// readPathsFile reads newline delimited paths from a file, decompressing gzip lists on the fly
+// "-" reads from stdin
+func readPathsFile(name string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	buffered := bufio.NewReader(r)
+	if magic, _ := buffered.Peek(len(gzipMagic)); !bytes.Equal(magic, gzipMagic) {
+		return readPathList(buffered)
+	}
+	decompressed, err := gzip.NewReader(buffered)
+	if err != nil {
+		return nil, err
+	}
+	defer decompressed.Close()
+	return readPathList(decompressed)
+}
+
+// readPathList streams paths line by line, skipping empty lines and # comments
+// Lines are taken literally, they are not expanded as glob patterns
+// Only the line ending is stripped, CRLF included, spaces around a path are part of it
+func readPathList(r io.Reader) ([]string, error) {
+	var paths []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// expandGlobs replaces glob patterns with the paths they match
+// Patterns matching nothing are reported and dropped, duplicate paths are kept once
+func expandGlobs(patterns []string, logger *warmer.Logger) []string {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches := []string{pattern}
+		// Literal paths are kept even if missing, so that opening them reports the error
+		if hasGlobMeta(pattern) {
+			var err error
+			matches, err = filepath.Glob(pattern)
+			if err != nil {
+				logger.Warnf("Invalid glob pattern %q: %v\n", pattern, err)
+				continue
+			}
+			if len(matches) == 0 {
+				logger.Warnf("Warning: no files match %q\n", pattern)
+				continue
+			}
+		}
+
+		for _, match := range matches {
+			if seen[match] {
+				continue
+			}
+			seen[match] = true
+			paths = append(paths, match)
+		}
+	}
+	return paths
+}
+
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[\`)
+}
+
+// isExcluded matches the patterns against the base name and the path relative to root
+// A pattern ending with a separator, like .git/, only matches directories
+// A matching directory is skipped with everything in it
+func (c *pathCollector) isExcluded(root string, path string, isDir bool) bool {
+	relPath, err := filepath.Rel(root, path)
+	if err != nil {
+		relPath = path
+	}
+	name := filepath.Base(path)
+	for _, pattern := range c.excludes {
+		dirOnly := strings.HasSuffix(pattern, "/") || strings.HasSuffix(pattern, string(filepath.Separator))
+		if dirOnly {
+			if !isDir {
+				continue
+			}
+			pattern = pattern[:len(pattern)-1]
+		}
+		// Patterns are validated upfront, errors can't happen here
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, relPath); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// validateExcludes reports the first malformed pattern
+func validateExcludes(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// walkDirectory queues root for the workers, then takes what they find in walk order while they read on
+// order is the position of root in the walk it's part of, nil for a path given as input
+// Symlinks to directories start walks of their own when taken, so whether a directory was walked already is the same as with a sequential walk
+func (c *pathCollector) walkDirectory(root string, order []int) {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		c.logger.Errorf("Error resolving directory %s: %v\n", root, err)
+		return
+	}
+	if c.visited[realRoot] {
+		c.logger.Warnf("Skipping %s, directory %s was already walked\n", root, realRoot)
+		return
+	}
+	c.visited[realRoot] = true
+
+	node := newDirNode(root, root, order)
+	c.queue([]*dirNode{node})
+	c.take(node)
+}
+
+// take adds what was found in a directory to the files, subdirectories depth first
+// Entries are dropped once taken, only the directories read but not taken yet are held
+func (c *pathCollector) take(node *dirNode) {
+	c.wait(node)
+	for i := range node.entries {
+		entry := node.entries[i]
+		node.entries[i] = dirEntry{}
+		switch {
+		case entry.err != nil:
+			c.errs = append(c.errs, entry.err)
+		case entry.target != "":
+			c.walkDirectory(entry.target, append(slices.Clip(node.order), i))
+		case entry.dir != nil:
+			c.take(entry.dir)
+		default:
+			c.filePaths = append(c.filePaths, entry.file)
+		}
+	}
+}
+
+// wait returns once the workers read the directory, which they do next if they are at maxReadAheadDirs
+func (c *pathCollector) wait(node *dirNode) {
+	select {
+	case <-node.ready:
+	default:
+		c.mu.Lock()
+		c.waiting = node
+		c.cond.Broadcast()
+		c.mu.Unlock()
+		<-node.ready
+	}
+	c.mu.Lock()
+	c.readAhead--
+	c.cond.Broadcast()
+	c.mu.Unlock()
+}
+
+func (c *pathCollector) queue(nodes []*dirNode) {
+	if len(nodes) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, node := range nodes {
+		heap.Push(&c.pending, node)
+	}
+	c.cond.Broadcast()
+}
+
+// start runs the workers reading the queued directories, until stop
+func (c *pathCollector) start(workers int) {
+	for i := 0; i < workers; i++ {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			for {
+				c.mu.Lock()
+				for !c.stopped && (len(c.pending) == 0 || (c.readAhead >= maxReadAheadDirs && c.pending[0] != c.waiting)) {
+					c.cond.Wait()
+				}
+				if c.stopped {
+					c.mu.Unlock()
+					return
+				}
+				node := heap.Pop(&c.pending).(*dirNode)
+				c.readAhead++
+				c.mu.Unlock()
+				c.read(node)
+			}
+		}()
+	}
+}
+
+func (c *pathCollector) stop() {
+	c.mu.Lock()
+	c.stopped = true
+	c.cond.Broadcast()
+	c.mu.Unlock()
+	c.wg.Wait()
+}
+
+// read lists the entries of the directory, its subdirectories are queued to be read too
+func (c *pathCollector) read(node *dirNode) {
+	var children []*dirNode
+	// Sorted by name like WalkDir, the entries read before an error are still walked
+	entries, err := os.ReadDir(node.path)
+	if err != nil {
+		c.logger.Errorf("Error reading %s: %v\n", node.path, err)
+	}
+	for _, entry := range entries {
+		path := filepath.Join(node.path, entry.Name())
+		if c.isExcluded(node.root, path, entry.IsDir()) {
+			c.excluded.Add(1)
+			continue
+		}
+
+		if entry.IsDir() {
+			if c.recursive {
+				child := newDirNode(path, node.root, append(slices.Clip(node.order), len(node.entries)))
+				node.entries = append(node.entries, dirEntry{dir: child})
+				children = append(children, child)
+			}
+			continue
+		}
+
+		mode := entry.Type()
+		if mode&fs.ModeSymlink != 0 {
+			info, err := c.resolveSymlink(path)
+			if err != nil {
+				node.entries = append(node.entries, dirEntry{err: err})
+			}
+			if info == nil {
+				continue
+			}
+			// Reading doesn't follow links, the target is walked on its own
+			if info.IsDir() {
+				if c.recursive {
+					node.entries = append(node.entries, dirEntry{target: path})
+				}
+				continue
+			}
+			mode = info.Mode().Type()
+		}
+
+		// Sockets, FIFOs and device nodes can block forever on open / read
+		if !mode.IsRegular() {
+			c.logger.Infof("Skipping non-regular file: %s\n", path)
+			continue
+		}
+
+		node.entries = append(node.entries, dirEntry{file: path})
+	}
+	c.queue(children)
+	close(node.ready)
+}
+
+// statPaths stats the paths with workers goroutines, infos[i] is nil if paths[i] couldn't be stat'ed
+func statPaths(paths []string, workers int) []fs.FileInfo {
+	infos := make([]fs.FileInfo, len(paths))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < min(workers, len(paths)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if info, err := os.Stat(paths[i]); err == nil {
+					infos[i] = info
+				}
+			}
+		}()
+	}
+	for i := range paths {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return infos
+}
+
+// filterBySize leaves out the regular files smaller than minSize or larger than maxSize, 0 disables a bound
+// Other paths are kept, e.g. block devices or paths that can't be stat'ed, which fail when opened
+// The files are stat'ed by workers goroutines
+func filterBySize(filePaths []string, minSize int64, maxSize int64, workers int, logger *warmer.Logger) []string {
+	if minSize == 0 && maxSize == 0 {
+		return filePaths
+	}
+	var smaller, larger int
+	infos := statPaths(filePaths, workers)
+	filtered := filePaths[:0]
+	for i, path := range filePaths {
+		info := infos[i]
+		switch {
+		case info == nil || !info.Mode().IsRegular():
+		case minSize > 0 && info.Size() < minSize:
+			smaller++
+			continue
+		case maxSize > 0 && info.Size() > maxSize:
+			larger++
+			continue
+		}
+		filtered = append(filtered, path)
+	}
+	if minSize > 0 {
+		logger.Infof("Excluded %d files smaller than %d bytes\n", smaller, minSize)
+	}
+	if maxSize > 0 {
+		logger.Infof("Excluded %d files larger than %d bytes\n", larger, maxSize)
+	}
+	return filtered
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"file_warmer/warmer"
+)
+
+func TestCollectFilePathsInWalkOrder(t *testing.T) {
+	// More directories than are read ahead, so the walk waits on the workers and they on the walk
+	root := t.TempDir()
+	for i := 0; i < 30; i++ {
+		for j := 0; j < 12; j++ {
+			dir := filepath.Join(root, fmt.Sprintf("d%02d", i), fmt.Sprintf("e%02d", j))
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			for k := 0; k < 3; k++ {
+				if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%d", k)), nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if err := os.WriteFile(filepath.Join(root, fmt.Sprintf("d%02d", i), "top"), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var want []string
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.Type().IsRegular() {
+			want = append(want, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := warmer.NewLogger(io.Discard, warmer.LevelError)
+	for _, workers := range []int{1, 8} {
+		got, err := collectFilePaths([]string{root}, true, false, nil, workers, logger)
+		if err != nil {
+			t.Fatalf("collectFilePaths with %d workers: %v", workers, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("collectFilePaths with %d workers found %d files out of walk order, want %d", workers, len(got), len(want))
+		}
+	}
+}
+
+func TestReadPathList(t *testing.T) {
+	tests := []struct {
+		name string
+		list string
+		want []string
+	}{
+		{"one per line", "/data/a\n/data/b\n", []string{"/data/a", "/data/b"}},
+		{"no final newline", "/data/a\n/data/b", []string{"/data/a", "/data/b"}},
+		{"CRLF", "/data/a\r\n/data/b\r\n", []string{"/data/a", "/data/b"}},
+		{"empty lines and comments", "\n# data\n/data/a\n\n", []string{"/data/a"}},
+		{"spaces are part of the path", " /data/a \n/data/b\t\n", []string{" /data/a ", "/data/b\t"}},
+		{"glob patterns are literal", "/data/*.img\n", []string{"/data/*.img"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := readPathList(strings.NewReader(test.list))
+			if err != nil || !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("readPathList(%q) = %q, %v, want %q", test.list, got, err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"file_warmer/warmer"
+)
+
+const (
+	progressBarRefreshInterval = 250 * time.Millisecond
+	// Without a terminal a line is logged this often instead of redrawing
+	progressLogInterval = 5 * time.Second
+	progressBarWidth    = 30
+)
+
+// showProgress renders the progress of a running warmup to stderr until ctx is done
+// The returned channel is closed once the final line has been written
+func showProgress(ctx context.Context, counters *warmer.Counters, logger *warmer.Logger) <-chan struct{} {
+	done := make(chan struct{})
+	interactive := isTerminal(os.Stderr)
+	interval := progressBarRefreshInterval
+	if !interactive {
+		interval = progressLogInterval
+	}
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		startTime := time.Now()
+		lastTime, lastBytes := startTime, int64(0)
+		for {
+			final := false
+			select {
+			case <-ctx.Done():
+				final = true
+			case <-ticker.C:
+			}
+
+			// Throughput over the last interval, the overall average hides stalls
+			now := time.Now()
+			bytesRead := counters.BytesRead.Load()
+			throughput := float64(bytesRead-lastBytes) / 1024 / 1024 / now.Sub(lastTime).Seconds()
+			lastTime, lastBytes = now, bytesRead
+
+			line := progressLine(counters, throughput, now.Sub(startTime))
+			if interactive {
+				fmt.Fprintf(os.Stderr, "\r\033[K%s", line)
+				if final {
+					fmt.Fprintln(os.Stderr)
+				}
+			} else if !final {
+				logger.Infof("%s\n", line)
+			}
+
+			if final {
+				return
+			}
+		}
+	}()
+	return done
+}
+
+func progressLine(counters *warmer.Counters, throughput float64, elapsed time.Duration) string {
+	blocksDone, blocksTotal := counters.BlocksDone.Load(), counters.BlocksTotal.Load()
+	bytesRead, bytesTotal := counters.BytesRead.Load(), counters.BytesTotal.Load()
+
+	var fraction float64
+	if bytesTotal > 0 {
+		fraction = min(float64(bytesRead)/float64(bytesTotal), 1)
+	}
+	filled := int(fraction * progressBarWidth)
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", progressBarWidth-filled)
+
+	// Estimate from the average throughput, a single slow interval shouldn't swing it
+	eta := "?"
+	if bytesRead > 0 && bytesTotal > bytesRead {
+		remaining := time.Duration(float64(elapsed) * float64(bytesTotal-bytesRead) / float64(bytesRead))
+		eta = remaining.Round(time.Second).String()
+	} else if bytesTotal > 0 && bytesRead >= bytesTotal {
+		eta = "0s"
+	}
+
+	return fmt.Sprintf("[%s] %5.1f%% %d/%d blocks %.2f MB/s ETA %s", bar, fraction*100, blocksDone, blocksTotal, throughput, eta)
+}
+
+// isTerminal reports if the file is a character device, which a terminal is
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
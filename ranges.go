@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"file_warmer/warmer"
+)
+
+// splitRange splits a path@offset:length argument into the path and its byte range
+// The length may be left out to warm up to the end, e.g. disk.img@1G:
+// Paths that exist as given are taken literally, names can contain @ too
+func splitRange(arg string) (string, *warmer.ByteRange, error) {
+	at := strings.LastIndex(arg, "@")
+	if at < 0 || !strings.Contains(arg[at+1:], ":") {
+		return arg, nil, nil
+	}
+	if _, err := os.Lstat(arg); err == nil {
+		return arg, nil, nil
+	}
+
+	offset, length, _ := strings.Cut(arg[at+1:], ":")
+	var byteRange warmer.ByteRange
+	var err error
+	if byteRange.Offset, err = parseSize(offset); err != nil {
+		return "", nil, fmt.Errorf("invalid range offset of %s: %w", arg, err)
+	}
+	if length != "" {
+		if byteRange.Length, err = parseSize(length); err != nil {
+			return "", nil, fmt.Errorf("invalid range length of %s: %w", arg, err)
+		}
+		if byteRange.Length == 0 {
+			return "", nil, fmt.Errorf("invalid range length of %s: must be positive", arg)
+		}
+	}
+	return arg[:at], &byteRange, nil
+}
+
+// splitRanges strips the byte ranges off the paths and collects them by cleaned path
+func splitRanges(paths []string, ranges map[string]warmer.ByteRange) ([]string, error) {
+	stripped := make([]string, 0, len(paths))
+	for _, path := range paths {
+		path, byteRange, err := splitRange(path)
+		if err != nil {
+			return nil, err
+		}
+		if byteRange != nil {
+			ranges[filepath.Clean(path)] = *byteRange
+		}
+		stripped = append(stripped, path)
+	}
+	return stripped, nil
+}
+
+// warnUnusedRanges tells about ranges given for directories or paths that aren't warmed
+func warnUnusedRanges(ranges map[string]warmer.ByteRange, filePaths []string, logger *warmer.Logger) {
+	warmed := make(map[string]bool, len(filePaths))
+	for _, filePath := range filePaths {
+		warmed[filepath.Clean(filePath)] = true
+	}
+	for path := range ranges {
+		if !warmed[path] {
+			logger.Warnf("Ignoring the range of %s, it's not a file being warmed\n", path)
+		}
+	}
+}
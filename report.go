@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"file_warmer/warmer"
+)
+
+// createReport creates the file for --report along with its parent directories
+func createReport(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	return os.Create(path)
+}
+
+// writeFailures writes the paths of the failed files one per line, the format --from-file reads
+// Files warmed with a range keep it, a retry warms the same bytes, and no failures leave the file empty
+func writeFailures(w io.Writer, stats warmer.Result, ranges map[string]warmer.ByteRange) error {
+	var buffer bytes.Buffer
+	for _, failure := range stats.Failures {
+		buffer.WriteString(failure.Path)
+		if byteRange, ok := ranges[filepath.Clean(failure.Path)]; ok {
+			fmt.Fprintf(&buffer, "@%d:", byteRange.Offset)
+			if byteRange.Length > 0 {
+				fmt.Fprintf(&buffer, "%d", byteRange.Length)
+			}
+		}
+		buffer.WriteByte('\n')
+	}
+	_, err := w.Write(buffer.Bytes())
+	return err
+}
+
+func formatLatency(latency warmer.LatencyStats) string {
+	return fmt.Sprintf("p50 %.3f ms, p90 %.3f ms, p99 %.3f ms, max %.3f ms (%d reads)", latency.P50Ms, latency.P90Ms, latency.P99Ms, latency.MaxMs, latency.Reads)
+}
+
+func logStats(logger *warmer.Logger, stats warmer.Result) {
+	totalData := (float64(stats.TotalBytes) / 1024 / 1024) // MB
+	logger.Infof("~~~ Overall Stats ~~~ \n")
+	logger.Infof("Total time: %.2f seconds\n", stats.TotalSeconds)
+	logger.Infof("Total data: %.2f MB\n", totalData)
+	logger.Infof("Average throughput: %.2f MB/s\n", stats.ThroughputMBs)
+	if stats.SkippedBlocks > 0 {
+		logger.Infof("Skipped blocks already in page cache: %d\n", stats.SkippedBlocks)
+	}
+	if stats.HoleBlocks > 0 {
+		logger.Infof("Skipped blocks in holes: %d\n", stats.HoleBlocks)
+	}
+	if stats.FailedBlocks > 0 {
+		logger.Infof("Failed blocks: %d\n", stats.FailedBlocks)
+	}
+	if stats.FailedFiles > 0 {
+		logger.Infof("Failed files: %d of %d\n", stats.FailedFiles, stats.FileCount)
+	}
+	if stats.TimedOutFiles > 0 {
+		logger.Infof("Timed out files: %d of %d\n", stats.TimedOutFiles, stats.FileCount)
+	}
+	if stats.PartialFiles > 0 {
+		logger.Infof("Partially warmed files: %d of %d, %.2f MB missing\n", stats.PartialFiles, stats.FileCount, float64(stats.MissingBytes)/1024/1024)
+	}
+	if stats.RemovedFiles > 0 {
+		logger.Infof("Files removed during warm: %d of %d\n", stats.RemovedFiles, stats.FileCount)
+	}
+	if stats.ChecksumMismatches > 0 {
+		logger.Infof("Checksum mismatches: %d of %d\n", stats.ChecksumMismatches, stats.FileCount)
+	}
+
+	// Slow reads stand out against the percentiles of the file, e.g. cold fetches from the backing store
+	if stats.Latency != nil {
+		logger.Infof("~~~ Read latency ~~~ \n")
+		logger.Infof("All files: %s\n", formatLatency(*stats.Latency))
+		for _, file := range stats.Files {
+			if file.Latency != nil {
+				logger.Infof("%s: %s\n", file.Path, formatLatency(*file.Latency))
+			}
+		}
+	}
+
+	// Errors got logged as they happened, between everything else, so a single list to retry from helps
+	if len(stats.Failures) > 0 {
+		logger.Errorf("~~~ Failed files (%d) ~~~ \n", len(stats.Failures))
+		for _, failure := range stats.Failures {
+			logger.Errorf("%s: %s\n", failure.Path, failure.Error)
+		}
+	}
+}
+
+// measureResidency measures the page cache residency of the files, those failing are only warned about
+func measureResidency(filePaths []string, logger *warmer.Logger) []warmer.FileResidency {
+	residencies, err := warmer.Residency(filePaths)
+	if err != nil {
+		logger.Warnf("Error measuring page cache residency: %v\n", err)
+	}
+	return residencies
+}
+
+// residentPercent is the share of the file in page cache, empty files count as fully cached
+func residentPercent(residency warmer.FileResidency) float64 {
+	if residency.SizeBytes == 0 {
+		return 100
+	}
+	return float64(residency.ResidentBytes) / float64(residency.SizeBytes) * 100
+}
+
+// logResidency logs a table with the share of every file in page cache before and after, files measured only once are left out
+// Residency not going up means the files weren't cached, e.g. the backend doesn't populate page cache on this filesystem
+func logResidency(logger *warmer.Logger, before []warmer.FileResidency, after []warmer.FileResidency) {
+	beforeByPath := make(map[string]warmer.FileResidency, len(before))
+	for _, residency := range before {
+		beforeByPath[residency.Path] = residency
+	}
+	percent := residentPercent
+
+	var table bytes.Buffer
+	writer := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "Path\tBefore (%)\tAfter (%)\tDelta (%)")
+	var totalBefore, totalAfter warmer.FileResidency
+	for _, residencyAfter := range after {
+		residencyBefore, ok := beforeByPath[residencyAfter.Path]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(writer, "%s\t%.1f\t%.1f\t%+.1f\n", residencyAfter.Path, percent(residencyBefore), percent(residencyAfter), percent(residencyAfter)-percent(residencyBefore))
+		totalBefore.SizeBytes += residencyAfter.SizeBytes
+		totalBefore.ResidentBytes += residencyBefore.ResidentBytes
+		totalAfter.SizeBytes += residencyAfter.SizeBytes
+		totalAfter.ResidentBytes += residencyAfter.ResidentBytes
+	}
+	writer.Flush()
+
+	logger.Infof("~~~ Page cache residency ~~~ \n")
+	for _, line := range strings.Split(strings.TrimRight(table.String(), "\n"), "\n") {
+		logger.Infof("%s\n", line)
+	}
+	logger.Infof("All files: %.1f%% before, %.1f%% after, %.2f MB more in page cache\n", percent(totalBefore), percent(totalAfter), float64(totalAfter.ResidentBytes-totalBefore.ResidentBytes)/1024/1024)
+}
+
+// logFileStats logs a table with a row per file, handy to spot the slow ones
+func logFileStats(logger *warmer.Logger, files []warmer.FileStat) {
+	var table bytes.Buffer
+	writer := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "Path\tSize (MB)\tTime (s)\tThroughput (MB/s)\tVerify\tError")
+	for _, file := range files {
+		fileErr := file.Error
+		if file.Removed {
+			fileErr = "removed during warm"
+		}
+		fmt.Fprintf(writer, "%s\t%.2f\t%.2f\t%.2f\t%s\t%s\n", file.Path, float64(file.SizeBytes)/1024/1024, file.DurationSeconds, file.ThroughputMBs, file.Verify, fileErr)
+	}
+	writer.Flush()
+
+	logger.Infof("~~~ Per File Stats ~~~ \n")
+	for _, line := range strings.Split(strings.TrimRight(table.String(), "\n"), "\n") {
+		logger.Infof("%s\n", line)
+	}
+}
+
+// writeJSON writes the stats (or a plan) as a single JSON object
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func logPlan(logger *warmer.Logger, plan warmer.Plan) {
+	for _, file := range plan.Files {
+		if file.Error != "" {
+			logger.Errorf("Cannot warm %s: %s\n", file.Path, file.Error)
+			continue
+		}
+		logger.Infof("Would warm %s: %.2f MB in %d blocks\n", file.Path, float64(file.WarmBytes)/1024/1024, file.Blocks)
+		if file.Explain != nil {
+			logFileExplanation(logger, *file.Explain)
+		}
+	}
+	logger.Infof("~~~ Dry Run ~~~ \n")
+	logger.Infof("Files: %d\n", plan.FileCount)
+	logger.Infof("Total data: %.2f MB\n", float64(plan.TotalBytes)/1024/1024)
+	logger.Infof("Total blocks: %d\n", plan.TotalBlocks)
+	logger.Infof("Estimated time: %.2f seconds at %.2f MB/s\n", plan.EstimatedSeconds, plan.AssumedRateMBs)
+	if dispatch := plan.Dispatch; dispatch != nil {
+		if dispatch.Backend != "" {
+			logger.Infof("Dispatch: files handed to the %s backend one after the other, no workers\n", dispatch.Backend)
+			return
+		}
+		pools := "shared by all disks"
+		if dispatch.PerDiskPools {
+			pools = "per disk"
+		}
+		logger.Infof("Dispatch: %s, %d files at a time per group, %d workers for small files and %d for large files %s\n", dispatch.Mode, dispatch.Lanes, dispatch.SmallFileWorkers, dispatch.LargeFileWorkers, pools)
+	}
+}
+
+// logFileExplanation logs how the blocks of a file would be read, spans past the first few are only counted
+func logFileExplanation(logger *warmer.Logger, explanation warmer.FileExplanation) {
+	readSize := fmt.Sprintf("%d blocks per read", explanation.BlocksPerRead)
+	if explanation.Adaptive {
+		readSize = fmt.Sprintf("up to %d blocks per read (adaptive)", explanation.BlocksPerRead)
+	}
+	logger.Infof("  %d byte blocks, %s, %d workers, %s order\n", explanation.BlockSize, readSize, explanation.Workers, explanation.Order)
+	for _, span := range explanation.Spans {
+		if explanation.Order == "strided" {
+			logger.Infof("  Worker %d: blocks %d to %d\n", span.Worker, span.FirstBlock, span.EndBlock-1)
+		} else {
+			logger.Infof("  Blocks %d to %d\n", span.FirstBlock, span.EndBlock-1)
+		}
+	}
+	if explanation.MoreSpans > 0 {
+		logger.Infof("  ... and %d more spans\n", explanation.MoreSpans)
+	}
+}
+
+// repeatReport compares the runs of --repeat
+type repeatReport struct {
+	Runs                []warmer.Result `json:"runs"`
+	MeanThroughputMBs   float64         `json:"mean_throughput_mb_s"`
+	StddevThroughputMBs float64         `json:"stddev_throughput_mb_s"`
+	// The failures of the last run, with --write-failures and --format=json
+	FailuresPath string `json:"failures_path,omitempty"`
+}
+
+// newRepeatReport computes the mean and sample standard deviation of the throughput of the runs
+func newRepeatReport(runs []warmer.Result) repeatReport {
+	report := repeatReport{Runs: runs}
+	for _, run := range runs {
+		report.MeanThroughputMBs += run.ThroughputMBs / float64(len(runs))
+	}
+	if len(runs) > 1 {
+		var squares float64
+		for _, run := range runs {
+			squares += (run.ThroughputMBs - report.MeanThroughputMBs) * (run.ThroughputMBs - report.MeanThroughputMBs)
+		}
+		report.StddevThroughputMBs = math.Sqrt(squares / float64(len(runs)-1))
+	}
+	return report
+}
+
+func logRepeatReport(logger *warmer.Logger, report repeatReport) {
+	var table bytes.Buffer
+	writer := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "Run\tTime (s)\tData (MB)\tThroughput (MB/s)\tFailed files")
+	for i, run := range report.Runs {
+		fmt.Fprintf(writer, "%d\t%.2f\t%.2f\t%.2f\t%d\n", i+1, run.TotalSeconds, float64(run.TotalBytes)/1024/1024, run.ThroughputMBs, run.FailedFiles)
+	}
+	writer.Flush()
+
+	logger.Infof("~~~ Runs ~~~ \n")
+	for _, line := range strings.Split(strings.TrimRight(table.String(), "\n"), "\n") {
+		logger.Infof("%s\n", line)
+	}
+	logger.Infof("Mean throughput: %.2f MB/s\n", report.MeanThroughputMBs)
+	logger.Infof("Stddev throughput: %.2f MB/s\n", report.StddevThroughputMBs)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"file_warmer/warmer"
+)
+
+// throughputSample is the throughput over one sample interval, and since the warmup started
+type throughputSample struct {
+	Time          time.Time `json:"time"`
+	BytesRead     int64     `json:"bytes_read"`
+	IntervalMBs   float64   `json:"interval_mb_s"`
+	CumulativeMBs float64   `json:"cumulative_mb_s"`
+}
+
+// Samples are taken this often for --min-throughput alone, without --sample-interval
+const throughputGuardInterval = time.Second
+
+// throughputError is the cause of the warmup context once the throughput stayed below --min-throughput
+type throughputError struct {
+	minMBs float64
+	window time.Duration
+}
+
+func (e throughputError) Error() string {
+	return fmt.Sprintf("throughput below %.2f MB/s for %s", e.minMBs, e.window)
+}
+
+// throughputGuard aborts the warmup once every sample of a window was below the minimum
+// Samples during the grace period after the start don't count, e.g. while the first files are opened
+type throughputGuard struct {
+	minMBs float64
+	grace  time.Duration
+	window time.Duration
+	abort  context.CancelCauseFunc
+	// Start of the first sample of the current run of slow ones, zero while fast enough
+	slowSince time.Time
+}
+
+// check is called with every sample, interval is the time the sample covers
+func (g *throughputGuard) check(sample throughputSample, interval time.Duration, elapsed time.Duration, logger *warmer.Logger) {
+	if elapsed < g.grace {
+		return
+	}
+	if sample.IntervalMBs >= g.minMBs {
+		g.slowSince = time.Time{}
+		return
+	}
+	if g.slowSince.IsZero() {
+		g.slowSince = sample.Time.Add(-interval)
+	}
+	if sample.Time.Sub(g.slowSince) >= g.window {
+		err := throughputError{minMBs: g.minMBs, window: g.window}
+		logger.Errorf("Aborting, %v: %.2f MB/s over the last %s\n", err, sample.IntervalMBs, interval)
+		g.abort(err)
+	}
+}
+
+// throughputSampler takes a throughput sample every interval, from the byte counter of the warmup
+// Samples are logged, or written to a Unix socket as JSON lines when one is given
+// A quiet sampler only feeds the guard
+type throughputSampler struct {
+	interval time.Duration
+	counters *warmer.Counters
+	conn     net.Conn
+	logger   *warmer.Logger
+	quiet    bool
+	guard    *throughputGuard
+	// Bytes per second of the last sample, as float64 bits for the metrics
+	last atomic.Uint64
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newThroughputSampler connects to socketPath if given, so a socket nobody listens on is reported before warming starts
+func newThroughputSampler(interval time.Duration, socketPath string, counters *warmer.Counters, logger *warmer.Logger) (*throughputSampler, error) {
+	s := &throughputSampler{interval: interval, counters: counters, logger: logger, stop: make(chan struct{}), done: make(chan struct{})}
+	if socketPath != "" {
+		conn, err := net.Dial("unix", socketPath)
+		if err != nil {
+			return nil, err
+		}
+		s.conn = conn
+	}
+	return s, nil
+}
+
+// start samples until close is called
+func (s *throughputSampler) start() {
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		startTime := time.Now()
+		lastTime, lastBytes := startTime, int64(0)
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+
+			now := time.Now()
+			bytesRead := s.counters.BytesRead.Load()
+			rate := float64(bytesRead-lastBytes) / now.Sub(lastTime).Seconds()
+			lastTime, lastBytes = now, bytesRead
+			s.last.Store(math.Float64bits(rate))
+
+			sample := throughputSample{
+				Time:          now,
+				BytesRead:     bytesRead,
+				IntervalMBs:   rate / 1024 / 1024,
+				CumulativeMBs: float64(bytesRead) / 1024 / 1024 / now.Sub(startTime).Seconds(),
+			}
+			if !s.quiet {
+				s.write(sample)
+			}
+			if s.guard != nil {
+				s.guard.check(sample, s.interval, now.Sub(startTime), s.logger)
+			}
+		}
+	}()
+}
+
+func (s *throughputSampler) write(sample throughputSample) {
+	if s.conn == nil {
+		s.logger.Infof("Throughput: %.2f MB/s over the last %s, %.2f MB/s cumulative, %.2f MB read\n", sample.IntervalMBs, s.interval, sample.CumulativeMBs, float64(sample.BytesRead)/1024/1024)
+		return
+	}
+	line, _ := json.Marshal(sample)
+	if _, err := s.conn.Write(append(line, '\n')); err != nil {
+		// The reader went away, the warmup goes on with the samples logged instead
+		s.logger.Warnf("Error writing throughput sample, logging them from now on: %v\n", err)
+		s.conn.Close()
+		s.conn = nil
+		s.write(sample)
+	}
+}
+
+// lastRate returns the bytes per second of the last sample, 0 before the first one
+func (s *throughputSampler) lastRate() float64 {
+	return math.Float64frombits(s.last.Load())
+}
+
+// close stops sampling and closes the socket
+func (s *throughputSampler) close() {
+	close(s.stop)
+	<-s.done
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
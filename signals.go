@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"file_warmer/warmer"
+)
+
+// signalError is the cause of the warmup context once a signal stopped it
+// It unwraps to context.Canceled, so checks for a cancelled warmup still work
+type signalError struct {
+	signal syscall.Signal
+}
+
+func (e signalError) Error() string {
+	return "received " + e.signal.String()
+}
+
+func (e signalError) Unwrap() error {
+	return context.Canceled
+}
+
+// exitCode follows the shell convention of 128 plus the signal number, e.g. 130 for SIGINT
+func (e signalError) exitCode() int {
+	return 128 + int(e.signal)
+}
+
+// notifySignals returns a context cancelled with a signalError on SIGINT or SIGTERM
+// Only the first signal is caught, another one kills the process right away
+func notifySignals(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			cancel(signalError{signal: sig.(syscall.Signal)})
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+	return ctx, func() { cancel(nil) }
+}
+
+// notifyProgressDumps writes a snapshot of the progress to stderr on every SIGUSR1
+// Handy for warmups running in the background without --progress, stopped by the returned function
+func notifyProgressDumps(counters *warmer.Counters) func() {
+	// Notify without signals would relay all of them
+	if len(progressDumpSignals) == 0 {
+		return func() {}
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, progressDumpSignals...)
+	done := make(chan struct{})
+
+	go func() {
+		startTime := time.Now()
+		lastTime, lastBytes := startTime, int64(0)
+		for {
+			select {
+			case <-signals:
+			case <-done:
+				return
+			}
+
+			// Throughput since the last snapshot, the first one covers the whole warmup
+			now := time.Now()
+			bytesRead := counters.BytesRead.Load()
+			throughput := float64(bytesRead-lastBytes) / 1024 / 1024 / now.Sub(lastTime).Seconds()
+			lastTime, lastBytes = now, bytesRead
+
+			fmt.Fprintf(os.Stderr, "Progress: %.2f of %.2f MB warmed, %d of %d files done, %s elapsed, %.2f MB/s\n",
+				float64(bytesRead)/1024/1024, float64(counters.BytesTotal.Load())/1024/1024,
+				counters.FilesDone.Load(), counters.FilesTotal.Load(),
+				now.Sub(startTime).Round(time.Second), throughput)
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// No SIGUSR1 here, progress is only shown with --progress
+var progressDumpSignals []os.Signal
@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// progressDumpSignals ask a running warmup for a snapshot of its progress
+var progressDumpSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// No umask here, the socket gets the default permissions of the platform
+func setUmask(mask int) int {
+	return 0
+}
@@ -0,0 +1,10 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// setUmask sets the file mode creation mask and returns the previous one
+func setUmask(mask int) int {
+	return syscall.Umask(mask)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time, e.g. go build -ldflags "-X main.version=0.0.13 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// printVersion writes which build this is
+// Without -ldflags the commit and date are taken from the VCS info Go stamps into the binary, if there is any
+func printVersion(w io.Writer) {
+	revision, date := commit, buildDate
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && revision == "":
+				revision = setting.Value
+			case setting.Key == "vcs.time" && date == "":
+				date = setting.Value
+			}
+		}
+	}
+	if revision == "" {
+		revision = "unknown"
+	}
+	if date == "" {
+		date = "unknown"
+	}
+	fmt.Fprintf(w, "fwup %s\ncommit: %s\nbuilt: %s\ngo: %s %s/%s\n", version, revision, date, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,70 @@
+package warmer
+
+import "time"
+
+const (
+	// With Options.Adaptive reads grow up to this size, unless BlocksPerRead allows for more
+	adaptiveMaxReadSize int64 = 16 * 1024 * 1024 // 16MB
+	// Throughput is measured over this long before the read size of a file changes
+	adaptiveWindow = 250 * time.Millisecond
+	// A doubled read size has to be this much faster than the last one to be kept
+	adaptiveMinGain = 1.1
+)
+
+// readBlocks is the most blocks a worker reads at once, with blocks of blockSize
+func (opts Options) readBlocks(blockSize int64) int {
+	if opts.Adaptive {
+		return max(opts.BlocksPerRead, int(adaptiveMaxReadSize/blockSize))
+	}
+	return opts.BlocksPerRead
+}
+
+// readSizeTuner picks the blocks per read of a file from its throughput
+// Reads start at a single block and double every window while the throughput improves
+// Once it plateaus the last faster size is kept for the rest of the file
+type readSizeTuner struct {
+	blocks     int
+	prevBlocks int
+	maxBlocks  int
+	settled    bool
+	// Bytes of the file read when the current window started
+	windowStart time.Time
+	windowBytes int64
+	// Bytes per second of the last size that was faster
+	best float64
+}
+
+func newReadSizeTuner(maxBlocks int) *readSizeTuner {
+	return &readSizeTuner{blocks: 1, prevBlocks: 1, maxBlocks: maxBlocks}
+}
+
+// next returns the blocks of the next read of the file, readBytes is what it read so far
+// settled is only true on the call the size got settled on
+func (t *readSizeTuner) next(readBytes int64, now time.Time) (blocks int, settled bool) {
+	if t.settled {
+		return t.blocks, false
+	}
+	if t.windowStart.IsZero() {
+		t.windowStart, t.windowBytes = now, readBytes
+		return t.blocks, false
+	}
+	elapsed := now.Sub(t.windowStart)
+	if elapsed < adaptiveWindow {
+		return t.blocks, false
+	}
+
+	throughput := float64(readBytes-t.windowBytes) / elapsed.Seconds()
+	switch {
+	case throughput < t.best*adaptiveMinGain:
+		t.blocks = t.prevBlocks
+		t.settled = true
+	case t.blocks >= t.maxBlocks:
+		t.best = throughput
+		t.settled = true
+	default:
+		t.best = throughput
+		t.prevBlocks, t.blocks = t.blocks, min(t.blocks*2, t.maxBlocks)
+	}
+	t.windowStart, t.windowBytes = now, readBytes
+	return t.blocks, t.settled
+}
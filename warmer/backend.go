@@ -0,0 +1,80 @@
+package warmer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Backend warms a whole file at once, e.g. for storage with its own way of prefetching
+// size is the one found when the file was opened, opts are the ones Warm was called with
+// The file counts as fully read once Warm returns without an error
+type Backend interface {
+	Warm(ctx context.Context, file *os.File, size int64, opts Options) error
+}
+
+// BackendFunc adapts a function to a Backend
+type BackendFunc func(ctx context.Context, file *os.File, size int64, opts Options) error
+
+func (f BackendFunc) Warm(ctx context.Context, file *os.File, size int64, opts Options) error {
+	return f(ctx, file, size, opts)
+}
+
+// Methods reading blocks share the workers of a lane, so blocks of the next file are read while the last ones of a file finish
+// They aren't backends for that reason, a backend warms one file per call
+var blockMethods = map[FileIOMethod]bool{
+	PosixSync: true,
+	IOUring:   true,
+	ReadAhead: true,
+}
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[FileIOMethod]Backend{
+		WillNeed: BackendFunc(func(ctx context.Context, file *os.File, size int64, opts Options) error {
+			return adviseWillNeed(ctx, file, size, opts.WaitResident)
+		}),
+		Mmap: BackendFunc(func(ctx context.Context, file *os.File, size int64, opts Options) error {
+			return madviseWillNeed(ctx, file, size, opts.MmapPopulate)
+		}),
+	}
+)
+
+// RegisterBackend makes a backend usable as Options.Method under name
+// The names of the built in methods can't be taken
+func RegisterBackend(name FileIOMethod, backend Backend) error {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if name == "" || backend == nil {
+		return fmt.Errorf("invalid backend %q", name)
+	}
+	if _, ok := backends[name]; ok || blockMethods[name] {
+		return fmt.Errorf("backend %q is already registered", name)
+	}
+	backends[name] = backend
+	return nil
+}
+
+// Methods returns the names of all methods Warm accepts, the backends included
+func Methods() []FileIOMethod {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	methods := make([]FileIOMethod, 0, len(blockMethods)+len(backends))
+	for method := range blockMethods {
+		methods = append(methods, method)
+	}
+	for method := range backends {
+		methods = append(methods, method)
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i] < methods[j] })
+	return methods
+}
+
+func lookupBackend(method FileIOMethod) (Backend, bool) {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	backend, ok := backends[method]
+	return backend, ok
+}
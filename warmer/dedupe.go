@@ -0,0 +1,43 @@
+package warmer
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// dedupePaths drops paths naming a file seen before, keeping the first spelling
+// Paths are compared absolute and cleaned, then by device and inode, so hard links and symlinks collapse too
+// Paths that can't be stat'ed are kept, opening them reports the error
+// The info of every path kept is returned along with it, nil for the ones that can't be stat'ed
+func dedupePaths(filePaths []string) ([]string, []os.FileInfo, int) {
+	unique := make([]string, 0, len(filePaths))
+	infos := make([]os.FileInfo, 0, len(filePaths))
+	seen := make(map[string]bool, len(filePaths))
+	// Candidates for os.SameFile, a file can only be the same as one of the same size
+	bySize := make(map[int64][]os.FileInfo)
+
+outer:
+	for _, filePath := range filePaths {
+		absPath, err := filepath.Abs(filePath)
+		if err != nil {
+			absPath = filepath.Clean(filePath)
+		}
+		if seen[absPath] {
+			continue
+		}
+		seen[absPath] = true
+
+		info, err := os.Stat(filePath)
+		if err == nil {
+			for _, other := range bySize[info.Size()] {
+				if os.SameFile(info, other) {
+					continue outer
+				}
+			}
+			bySize[info.Size()] = append(bySize[info.Size()], info)
+		}
+		unique = append(unique, filePath)
+		infos = append(infos, info)
+	}
+	return unique, infos, len(filePaths) - len(unique)
+}
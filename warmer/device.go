@@ -0,0 +1,66 @@
+package warmer
+
+import (
+	"fmt"
+	"os"
+)
+
+// fileSize is the number of bytes to warm, the size of a regular file or the capacity of a block device
+// Block devices report a size of 0 when stat'ed, their capacity has to be asked for
+func fileSize(file *os.File, info os.FileInfo) (int64, error) {
+	mode := info.Mode()
+	switch {
+	case mode.IsRegular():
+		return info.Size(), nil
+	case isBlockDevice(mode):
+		size, err := blockDeviceSize(file)
+		if err != nil {
+			return 0, fmt.Errorf("size of block device %s: %w", file.Name(), err)
+		}
+		return size, nil
+	default:
+		return 0, fmt.Errorf("%s is not a regular file or block device", file.Name())
+	}
+}
+
+func isBlockDevice(mode os.FileMode) bool {
+	return mode&os.ModeDevice != 0 && mode&os.ModeCharDevice == 0
+}
+
+// isWarmable tells if a file can be warmed, FIFOs and character devices can block forever on open or read
+// Block devices are only warmed when named as input, they are never picked up from directories
+func isWarmable(mode os.FileMode) bool {
+	return mode.IsRegular() || isBlockDevice(mode)
+}
+
+// fileType names the type of file of mode, for messages about files that aren't warmed
+func fileType(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		return "named pipe"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeCharDevice != 0:
+		return "character device"
+	case mode.IsDir():
+		return "directory"
+	default:
+		return "special file"
+	}
+}
+
+// pathSize is fileSize for a path that isn't open, only block devices are opened to ask for their capacity
+func pathSize(path string, info os.FileInfo) (int64, error) {
+	if info.Mode().IsRegular() {
+		return info.Size(), nil
+	}
+	if !isBlockDevice(info.Mode()) {
+		return 0, fmt.Errorf("%s is not a regular file or block device", path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return fileSize(file, info)
+}
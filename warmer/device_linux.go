@@ -0,0 +1,21 @@
+//go:build linux
+
+package warmer
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// blockDeviceSize asks the kernel for the capacity of the block device in bytes
+// golang.org/x/sys/unix has no helper returning a uint64 for BLKGETSIZE64
+func blockDeviceSize(file *os.File) (int64, error) {
+	var size uint64
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, file.Fd(), unix.BLKGETSIZE64, uintptr(unsafe.Pointer(&size)))
+	if errno != 0 {
+		return 0, errno
+	}
+	return int64(size), nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package warmer
+
+import (
+	"errors"
+	"os"
+)
+
+func blockDeviceSize(file *os.File) (int64, error) {
+	return 0, errors.New("warming block devices is only supported on Linux")
+}
@@ -0,0 +1,36 @@
+//go:build unix
+
+package warmer
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestWarmSkipsFIFO(t *testing.T) {
+	dir := t.TempDir()
+	fifo := filepath.Join(dir, "fifo")
+	if err := unix.Mkfifo(fifo, 0o644); err != nil {
+		t.Skipf("can't create a FIFO: %v", err)
+	}
+	file := writeTestFile(t, dir, "file", 10000)
+
+	// Opening the FIFO would wait for a writer that never comes, until the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	result, err := Warm(ctx, []string{fifo, file}, testOptions())
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Warm took %v with a FIFO among the files", elapsed)
+	}
+	if err != nil {
+		t.Fatalf("Warm: %v", err)
+	}
+	if result.FileCount != 1 || result.TotalBytes != 10000 {
+		t.Fatalf("Warm warmed %d files of %d bytes, want only the regular file of 10000 bytes", result.FileCount, result.TotalBytes)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package warmer
+
+import "os"
+
+func deviceID(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
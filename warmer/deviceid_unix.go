@@ -0,0 +1,20 @@
+//go:build linux || darwin
+
+package warmer
+
+import (
+	"os"
+	"syscall"
+)
+
+// deviceID is the device the data of a file lives on, block devices are their own
+func deviceID(info os.FileInfo) (uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	if info.Mode()&os.ModeDevice != 0 {
+		return uint64(stat.Rdev), true
+	}
+	return uint64(stat.Dev), true
+}
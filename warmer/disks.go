@@ -0,0 +1,43 @@
+package warmer
+
+// diskFiles are the small and large files of a batch that live on the same device
+// With WorkersPerDisk every one of them is warmed by its own worker pools
+type diskFiles struct {
+	device    uint64
+	hasDevice bool
+	small     []*fileProgress
+	large     []*fileProgress
+}
+
+// splitByDevice buckets the files by device, in the order the devices first show up
+// Files without a device id, e.g. on platforms that don't report one, share a bucket
+func splitByDevice(small []*fileProgress, large []*fileProgress) []*diskFiles {
+	var disks []*diskFiles
+	byDevice := make(map[uint64]*diskFiles)
+	var unknown *diskFiles
+	diskOf := func(progress *fileProgress) *diskFiles {
+		if !progress.hasDevice {
+			if unknown == nil {
+				unknown = &diskFiles{}
+				disks = append(disks, unknown)
+			}
+			return unknown
+		}
+		disk, ok := byDevice[progress.device]
+		if !ok {
+			disk = &diskFiles{device: progress.device, hasDevice: true}
+			byDevice[progress.device] = disk
+			disks = append(disks, disk)
+		}
+		return disk
+	}
+	for _, progress := range small {
+		disk := diskOf(progress)
+		disk.small = append(disk.small, progress)
+	}
+	for _, progress := range large {
+		disk := diskOf(progress)
+		disk.large = append(disk.large, progress)
+	}
+	return disks
+}
@@ -0,0 +1,365 @@
+package warmer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DispatchMode picks how the blocks of the files of a lane are handed to its workers, see Options.Dispatch
+type DispatchMode string
+
+const (
+	// Dispatch all blocks of a file before the next one is started
+	DispatchSequential DispatchMode = "sequential"
+	// Dispatch runs of all pending files round robin, so they all make progress together
+	DispatchInterleave DispatchMode = "interleave"
+	// Dispatch runs of all pending files with shares inversely proportional to their size, so small files finish first
+	DispatchWeighted DispatchMode = "weighted"
+)
+
+// Blocks stepped over between checks of the file context, a sparse file can have billions of them
+// Skipping one is cheap, but a cancelled warmup shouldn't wait for all of them
+const contextCheckBlocks = 1 << 16
+
+// fileCursor is the position of the dispatcher within a file being warmed
+type fileCursor struct {
+	progress *fileProgress
+	fd       int
+	// Blocks are dispatched span after span, a run never crosses into the next one
+	spans     spanList
+	span      int
+	blockNum  int64
+	isSkipped func(blockNum int64) bool
+	// Picks the blocks per read with adaptive, nil reads runs of blocksPerRead
+	tuner *readSizeTuner
+	// Blocks to dispatch in total and sent to the workers so far
+	blocks     int64
+	dispatched int64
+	// Virtual time of the file with DispatchWeighted, the file furthest behind is sent next
+	pass float64
+}
+
+// dispatchFiles sends the blocks of files taken from the queue to the workers
+// With DispatchInterleave every file the queue hands out is taken right away, and one run of each is sent in turn
+// DispatchWeighted takes them the same way, but sends runs of the files in proportion to the inverse of their size
+// A file running into its timeout isn't dispatched any further, the next one is started right away
+// With Adaptive blocksPerRead is the most blocks per read, every file finds its own read size
+// With Stride the blocks of a file are dispatched in interleaved streams, see stridedSpans
+// With PatternRandom they are dispatched in runs shuffled by Seed, see randomSpans
+func dispatchFiles(ctx context.Context, queue *fileQueue, blockChan chan<- fileReadRequest, group *fileGroup) error {
+	dispatch, adaptive := group.opts.Dispatch, group.opts.Adaptive
+	blockSize, blocksPerRead, logger := group.blockSize, group.blocksPerRead, group.logger
+	var errs []error
+	var cursors []*fileCursor
+	// Virtual time of the last file sent from with DispatchWeighted
+	var pass float64
+	add := func(progress *fileProgress) {
+		cursor, err := prepareFile(ctx, progress, group)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		if cursor == nil {
+			return
+		}
+		if adaptive {
+			cursor.tuner = newReadSizeTuner(blocksPerRead)
+		}
+		// Starting where the others are, a file taken late doesn't catch up on the time it wasn't there
+		cursor.pass = pass
+		cursors = append(cursors, cursor)
+	}
+
+	for ctx.Err() == nil {
+		// Waiting for a file is only fine while nothing else is left to dispatch
+		if len(cursors) == 0 {
+			progress := queue.next(ctx)
+			if progress == nil {
+				break
+			}
+			add(progress)
+		}
+		if dispatch == DispatchInterleave || dispatch == DispatchWeighted {
+			for progress := queue.tryNext(); progress != nil; progress = queue.tryNext() {
+				add(progress)
+			}
+		}
+
+		// Stride scheduling: every run sent moves the file on by its length times the size of the file
+		// So a file ten times smaller gets ten times the runs, and the largest one still moves along
+		if dispatch == DispatchWeighted {
+			i := 0
+			for j, cursor := range cursors {
+				if cursor.pass < cursors[i].pass {
+					i = j
+				}
+			}
+			cursor := cursors[i]
+			dispatched := cursor.dispatched
+			done, err := cursor.send(ctx, blockChan, blockSize, blocksPerRead, logger)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if ctx.Err() != nil {
+				return errors.Join(errs...)
+			}
+			pass = cursor.pass
+			cursor.pass += float64(cursor.dispatched-dispatched) * float64(blockSize) * float64(max(cursor.progress.warmBytes, blockSize))
+			if done {
+				cursors = append(cursors[:i], cursors[i+1:]...)
+			}
+			continue
+		}
+
+		for i := 0; i < len(cursors); {
+			cursor := cursors[i]
+			done, err := cursor.send(ctx, blockChan, blockSize, blocksPerRead, logger)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if ctx.Err() != nil {
+				return errors.Join(errs...)
+			}
+			if done {
+				cursors = append(cursors[:i], cursors[i+1:]...)
+				continue
+			}
+			if dispatch == DispatchInterleave {
+				i++
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// prepareFile starts warming a file, returning where its blocks are to be dispatched from
+// Blocks in holes or already resident are left out according to SkipHoles and SkipCached
+// With PhysicalOrder the blocks are dispatched in the order they lie on disk, to save seeks on spinning disks
+// With Stride they are spread over the streams of the group instead, in runs of blocksPerRead
+// With PatternRandom those runs are shuffled, and readahead is turned off like with HintRandom
+// No cursor is returned when the warmup is cancelled meanwhile, there is nothing to dispatch
+func prepareFile(ctx context.Context, progress *fileProgress, group *fileGroup) (*fileCursor, error) {
+	opts, blockSize, blocksPerRead, stride, counters, logger := group.opts, group.blockSize, group.blocksPerRead, group.streams, group.counters, group.logger
+	method, skipCached, skipHoles, hint, pattern := opts.Method, opts.SkipCached, opts.SkipHoles, opts.FadviseHint, opts.Pattern
+	file := progress.file
+	logger.Infof("Warming up file: %s\n", file.Name())
+	progress.begin(ctx, opts.FileTimeout)
+
+	fd := int(file.Fd())
+	noDirect := opts.NoDirect || progress.buffered
+
+	// Residency has to be checked before anything is dropped
+	var resident []bool
+	if skipCached {
+		var err error
+		resident, err = residentBlocks(file, progress.size, blockSize)
+		if err != nil {
+			// Still warm the file, just all of it
+			logger.Warnf("Error checking page cache residency of %s, reading all blocks: %v\n", file.Name(), err)
+		}
+	}
+
+	// Without the extents every block is read, as if the file had no holes
+	var data []bool
+	if skipHoles {
+		var err error
+		data, err = dataBlocks(file, progress.size, blockSize)
+		if err != nil {
+			logger.Warnf("Error finding holes of %s, reading all blocks: %v\n", file.Name(), err)
+		}
+	}
+	isHole := func(blockNum int64) bool {
+		return data != nil && (blockNum >= int64(len(data)) || !data[blockNum])
+	}
+	isResident := func(blockNum int64) bool {
+		return blockNum < int64(len(resident)) && resident[blockNum]
+	}
+
+	// readahead exists to fill page cache, dropping it first would be pointless
+	// Same when skipping cached blocks, they'd no longer be cached, or reading to fill the cache
+	if method != ReadAhead && !skipCached && !noDirect {
+		err := dropPageCache(fd)
+		if err != nil {
+			logger.Warnf("Error fadvise: %v\n", err)
+			err = fmt.Errorf("fadvise %s: %w", file.Name(), err)
+			progress.abort(err)
+			return nil, err
+		}
+	}
+
+	// Readahead past the run just read would be left in page cache, every block gets read anyway
+	// Reading in random order, readahead would only fetch what isn't read next
+	if progress.evictAfter || pattern == PatternRandom {
+		hint = HintRandom
+	}
+	// Readahead only happens for reads through page cache
+	if method == ReadAhead || noDirect {
+		if err := adviseAccessPattern(fd, hint); err != nil {
+			logger.Warnf("Error fadvise %s of %s: %v\n", hint, file.Name(), err)
+		}
+	}
+
+	// Only the blocks covering the range, or the head and tail, are warmed, none past the end of file
+	regions := regionSpans(progress.byteRange, progress.tail, progress.size, blockSize)
+
+	// Holes and resident blocks are left out of the totals, so progress still ends at 100%
+	var regionBlocks, regionBytes, holeBlocks, residentBlocks, skippedBytes int64
+	for _, region := range regions {
+		regionBlocks += region.end - region.start
+		regionBytes += spanBytes(region.start, region.end, progress.size, blockSize)
+		for blockNum := region.start; blockNum < region.end; blockNum++ {
+			if (blockNum-region.start)&(contextCheckBlocks-1) == 0 && progress.ctx.Err() != nil {
+				return nil, stopPreparing(ctx, progress, logger)
+			}
+			switch {
+			case isHole(blockNum):
+				holeBlocks++
+			case isResident(blockNum):
+				residentBlocks++
+			default:
+				continue
+			}
+			skippedBytes += max(min(blockSize, progress.size-blockNum*blockSize), 0)
+		}
+	}
+	if holeBlocks > 0 {
+		logger.Infof("Skipping %d blocks of %s in holes\n", holeBlocks, file.Name())
+		counters.BlocksHoles.Add(holeBlocks)
+	}
+	if residentBlocks > 0 {
+		logger.Infof("Skipping %d blocks of %s already in page cache\n", residentBlocks, file.Name())
+		counters.BlocksSkipped.Add(residentBlocks)
+	}
+	counters.BytesTotal.Add(-skippedBytes)
+	blocks := regionBlocks - holeBlocks - residentBlocks
+
+	warmBytes := regionBytes - skippedBytes
+	progress.start(blocks, warmBytes)
+	counters.BlocksTotal.Add(blocks)
+
+	// Fragmented files are read in logical order when the extents are unknown, e.g. on filesystems without FIEMAP
+	var extents []fileExtent
+	physical := opts.PhysicalOrder && stride == 0 && pattern != PatternRandom
+	if physical {
+		var err error
+		extents, err = fileExtents(file, progress.size)
+		if err != nil {
+			logger.Warnf("Error finding extents of %s, reading in logical order: %v\n", file.Name(), err)
+			physical = false
+		}
+	}
+	// Regions are read one after the other, each in the order asked for
+	var joined joinedSpans
+	for _, region := range regions {
+		var spans spanList = blockSpans{region}
+		if stride > 0 {
+			spans = newStridedSpans(region.start, region.end, stride, blocksPerRead)
+		} else if pattern == PatternRandom {
+			spans = newRandomSpans(region.start, region.end, blocksPerRead, opts.Seed, progress.path)
+		} else if physical {
+			spans = blockSpans(orderByPhysical(extents, region.start, region.end, blockSize))
+		}
+		joined = append(joined, spans)
+	}
+	var spans spanList = joined
+	if len(joined) == 1 {
+		spans = joined[0]
+	}
+	if physical {
+		logger.Debugf("Reading %s in %d spans ordered by physical offset\n", file.Name(), spans.len())
+	}
+
+	cursor := &fileCursor{
+		progress: progress,
+		fd:       fd,
+		spans:    spans,
+		isSkipped: func(blockNum int64) bool {
+			return isHole(blockNum) || isResident(blockNum)
+		},
+		blocks: blocks,
+	}
+	if spans.len() > 0 {
+		cursor.blockNum = spans.at(0).start
+	}
+	return cursor, nil
+}
+
+// stopPreparing gives up on a file whose context got done before any of its blocks were dispatched
+// A cancelled warmup isn't an error of the file, a file past its deadline is failed like with send
+func stopPreparing(ctx context.Context, progress *fileProgress, logger *Logger) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+	err := context.Cause(progress.ctx)
+	logger.Errorf("Giving up on %s: %v\n", progress.file.Name(), err)
+	progress.abort(err)
+	return fmt.Errorf("%s: %w", progress.file.Name(), err)
+}
+
+// send hands the next run of non skipped blocks to the workers, done is true once there is nothing left to send
+// A file whose context is done is given up on, the error says why
+func (c *fileCursor) send(ctx context.Context, blockChan chan<- fileReadRequest, blockSize int64, blocksPerRead int, logger *Logger) (bool, error) {
+	progress := c.progress
+	// Once every block to read was sent only skipped ones are left, there's no need to step over them
+	if c.dispatched == c.blocks {
+		c.span = c.spans.len()
+	}
+	for steps := 1; c.span < c.spans.len() && (c.blockNum >= c.spans.at(c.span).end || c.isSkipped(c.blockNum)); steps++ {
+		// Stopping halfway through skipped blocks, the file is given up on below
+		if steps&(contextCheckBlocks-1) == 0 && progress.ctx.Err() != nil {
+			break
+		}
+		if c.blockNum >= c.spans.at(c.span).end {
+			c.span++
+			if c.span < c.spans.len() {
+				c.blockNum = c.spans.at(c.span).start
+			}
+			continue
+		}
+		c.blockNum++
+	}
+	if c.span >= c.spans.len() {
+		if c.tuner != nil && !c.tuner.settled && c.dispatched > 0 {
+			logger.Debugf("Read %s with reads of %d bytes, done before the read size settled\n", progress.file.Name(), int64(c.tuner.blocks)*blockSize)
+		}
+		return true, nil
+	}
+
+	if progress.ctx.Err() == nil {
+		readBlocks := blocksPerRead
+		if c.tuner != nil {
+			var settled bool
+			readBlocks, settled = c.tuner.next(progress.readBytes.Load(), time.Now())
+			if settled {
+				logger.Infof("Reading %s with reads of %d bytes, at %.2f MB/s\n", progress.file.Name(), int64(readBlocks)*blockSize, c.tuner.best/1024/1024)
+			}
+		}
+		endBlock := c.spans.at(c.span).end
+		blocks := 1
+		for blocks < readBlocks && c.blockNum+int64(blocks) < endBlock && !c.isSkipped(c.blockNum+int64(blocks)) {
+			blocks++
+		}
+		select {
+		case blockChan <- fileReadRequest{fd: c.fd, offset: c.blockNum * blockSize, blocks: blocks, progress: progress}:
+			c.blockNum += int64(blocks)
+			c.dispatched += int64(blocks)
+			return false, nil
+		case <-progress.ctx.Done():
+		}
+	}
+	if ctx.Err() != nil {
+		return true, nil
+	}
+
+	// Blocks never dispatched are done too, so the file finishes once the workers let go of it
+	err := context.Cause(progress.ctx)
+	progress.skip(int(c.blocks - c.dispatched))
+	if errors.Is(err, errFileRemoved) {
+		logger.Warnf("Stopping %s, it was %v\n", progress.file.Name(), err)
+		return true, nil
+	}
+	logger.Errorf("Giving up on %s: %v\n", progress.file.Name(), err)
+	return true, fmt.Errorf("%s: %w", progress.file.Name(), err)
+}
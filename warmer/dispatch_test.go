@@ -0,0 +1,140 @@
+package warmer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSendStopsWhileSteppingOverSkippedBlocks(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "file", 4096)
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	progress := &fileProgress{file: file, path: path, size: 4096, counters: &Counters{}}
+	progress.begin(context.Background(), 0)
+	progress.start(1, 4096)
+
+	// Millions of skipped blocks before the only one to read, the file gets cancelled while stepping over them
+	const blocks = 1 << 24
+	stopped := errors.New("stopped")
+	steps := 0
+	cursor := &fileCursor{
+		progress: progress,
+		spans:    blockSpans{{start: 0, end: blocks}},
+		isSkipped: func(blockNum int64) bool {
+			steps++
+			if steps == 1000 {
+				progress.cancelCause(stopped)
+			}
+			return blockNum < blocks-1
+		},
+		blocks: 1,
+	}
+	blockChan := make(chan fileReadRequest, 1)
+	done, err := cursor.send(context.Background(), blockChan, 4096, 1, NewLogger(io.Discard, LevelError))
+	if !done || !errors.Is(err, stopped) || len(blockChan) != 0 {
+		t.Fatalf("send = %v, %v with %d blocks dispatched, want the file given up on", done, err, len(blockChan))
+	}
+	if steps > contextCheckBlocks {
+		t.Fatalf("send stepped over %d blocks after the file got cancelled, want at most %d", steps-1000, contextCheckBlocks-1000)
+	}
+}
+
+func TestPrepareFileStopsOnHugeSparseFile(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "sparse", 0)
+	const size = 1 << 40
+	if err := os.Truncate(path, size); err != nil {
+		t.Skipf("can't create a sparse file of %d bytes: %v", int64(size), err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	// Already past its deadline, the hundreds of millions of blocks aren't all looked at before giving up
+	opts := testOptions()
+	opts.FileTimeout = time.Nanosecond
+	counters := &Counters{}
+	group := newFileGroup(opts, 4096, 1, nil, nil, counters, opts.Logger)
+	progress := &fileProgress{file: file, path: path, size: size, counters: counters}
+	start := time.Now()
+	cursor, err := prepareFile(context.Background(), progress, group)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("prepareFile took %v to give up", elapsed)
+	}
+	if cursor != nil || !errors.Is(err, errFileTimeout) {
+		t.Fatalf("prepareFile = %v, %v, want the file given up on after its timeout", cursor, err)
+	}
+}
+
+func TestDispatchStopsWhenWarmupIsCancelled(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{writeTestFile(t, dir, "a", 1<<20), writeTestFile(t, dir, "b", 1<<20)}
+	for _, dispatch := range []DispatchMode{DispatchSequential, DispatchInterleave, DispatchWeighted} {
+		t.Run(string(dispatch), func(t *testing.T) {
+			opts := testOptions()
+			opts.Dispatch = dispatch
+			counters := &Counters{}
+			var files []*fileProgress
+			for _, path := range paths {
+				file, err := os.Open(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer file.Close()
+				files = append(files, &fileProgress{file: file, path: path, size: 1 << 20, counters: counters})
+			}
+			group := newFileGroup(opts, 4096, 1, nil, nil, counters, opts.Logger)
+
+			// No worker takes blocks off the channel, the dispatcher blocks on its first send
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			blockChan := make(chan fileReadRequest)
+			done := make(chan error, 1)
+			go func() { done <- dispatchFiles(ctx, newFileQueue(files, 0), blockChan, group) }()
+			select {
+			case err := <-done:
+				t.Fatalf("dispatchFiles = %v before any block was read", err)
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			cancel()
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatalf("dispatchFiles = %v, a cancelled warmup isn't an error of the files", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("dispatchFiles still sending a second after the warmup got cancelled")
+			}
+		})
+	}
+}
+
+func TestWarmStopsWhenCancelled(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "file", 16<<20)
+	// Slowed down to take far longer than the test waits, the warmup is cancelled midway
+	opts := testOptions()
+	opts.MaxRate = 1 << 20
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	result, err := Warm(ctx, []string{path}, opts)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Warm took %v to return after being cancelled", elapsed)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Warm = %v, want the warmup cancelled", err)
+	}
+	if result.TotalBytes >= 16<<20 {
+		t.Fatalf("Warm read all %d bytes though it got cancelled", result.TotalBytes)
+	}
+}
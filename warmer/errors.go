@@ -0,0 +1,52 @@
+package warmer
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// ErrChecksumMismatch is the error of a file read fine whose data didn't match its checksum
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// FileError is the error a single file failed with
+type FileError struct {
+	Path string
+	Err  error
+}
+
+// Error doesn't repeat the path when the error already names it, like the ones of os.Open
+func (e FileError) Error() string {
+	var pathErr *fs.PathError
+	if errors.As(e.Err, &pathErr) && pathErr.Path == e.Path {
+		return e.Err.Error()
+	}
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e FileError) Unwrap() error {
+	return e.Err
+}
+
+// WarmError is returned by Warm once files failed, errors.As reaches the FileError of every one of them
+// Errors that are not about a single file, like the reason a warmup got cancelled, are unwrapped along with them
+type WarmError struct {
+	files []FileError
+	other []error
+}
+
+func (e *WarmError) Error() string {
+	return errors.Join(e.Unwrap()...).Error()
+}
+
+// Errors returns the failed files, in the order they were warmed
+func (e *WarmError) Errors() []FileError {
+	return e.files
+}
+
+func (e *WarmError) Unwrap() []error {
+	errs := make([]error, 0, len(e.files)+len(e.other))
+	for _, file := range e.files {
+		errs = append(errs, file)
+	}
+	return append(errs, e.other...)
+}
@@ -0,0 +1,35 @@
+package warmer
+
+import (
+	"errors"
+	"os"
+)
+
+// evictRead drops a run a worker just read from page cache, with EvictAfter
+// The data was fetched from the backing store already, failing to drop it only leaves it cached
+func evictRead(progress *fileProgress, fd int, offset int64, length int64, logger *Logger) {
+	if !progress.evictAfter || length <= 0 {
+		return
+	}
+	if err := dropPageCacheRange(fd, offset, length); err != nil {
+		logger.Warnf("Error dropping bytes %d to %d of %s from page cache: %v\n", offset, offset+length, progress.path, err)
+	}
+}
+
+// Evict drops the files from page cache, e.g. so the next warmup of them starts cold
+// Only works where dropping page cache is supported, elsewhere it does nothing
+func Evict(filePaths []string) error {
+	var errs []error
+	for _, filePath := range filePaths {
+		file, err := os.Open(filePath)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := dropPageCache(int(file.Fd())); err != nil {
+			errs = append(errs, &os.PathError{Op: "fadvise", Path: filePath, Err: err})
+		}
+		file.Close()
+	}
+	return errors.Join(errs...)
+}
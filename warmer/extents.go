@@ -0,0 +1,55 @@
+package warmer
+
+import (
+	"cmp"
+	"slices"
+)
+
+// fileExtent maps length bytes at logical offset of a file to physical offset on disk
+type fileExtent struct {
+	logical  int64
+	physical int64
+	length   int64
+}
+
+// blockSpan covers the blocks from start up to end of a file
+type blockSpan struct {
+	start int64
+	end   int64
+}
+
+// orderByPhysical splits the blocks from first to end into spans ordered by where they lie on disk
+// A block goes with the extent its first byte is in, blocks in no extent are holes and come first, they cost no seek
+func orderByPhysical(extents []fileExtent, first, end, blockSize int64) []blockSpan {
+	type mappedSpan struct {
+		blockSpan
+		physical int64
+	}
+	var holes []blockSpan
+	var mapped []mappedSpan
+	covered := first
+	for _, extent := range extents {
+		start := max((extent.logical+blockSize-1)/blockSize, covered)
+		stop := min((extent.logical+extent.length+blockSize-1)/blockSize, end)
+		if start >= stop {
+			continue
+		}
+		if start > covered {
+			holes = append(holes, blockSpan{start: covered, end: start})
+		}
+		mapped = append(mapped, mappedSpan{blockSpan: blockSpan{start: start, end: stop}, physical: extent.physical + start*blockSize - extent.logical})
+		covered = stop
+	}
+	if covered < end {
+		holes = append(holes, blockSpan{start: covered, end: end})
+	}
+
+	slices.SortStableFunc(mapped, func(a, b mappedSpan) int {
+		return cmp.Compare(a.physical, b.physical)
+	})
+	spans := holes
+	for _, span := range mapped {
+		spans = append(spans, span.blockSpan)
+	}
+	return spans
+}
@@ -0,0 +1,69 @@
+//go:build linux
+
+package warmer
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// golang.org/x/sys/unix has no FIEMAP support, the layout follows linux/fiemap.h
+// https://www.kernel.org/doc/html/latest/filesystems/fiemap.html
+const (
+	fsIOCFiemap       = 0xC020660B // _IOWR('f', 11, struct fiemap)
+	fiemapFlagSync    = 0x1        // Flush dirty pages first, so delayed allocations are mapped too
+	fiemapExtentLast  = 0x1
+	fiemapExtentBatch = 256
+)
+
+type fiemapHeader struct {
+	start         uint64
+	length        uint64
+	flags         uint32
+	mappedExtents uint32
+	extentCount   uint32
+	reserved      uint32
+}
+
+type fiemapExtent struct {
+	logical    uint64
+	physical   uint64
+	length     uint64
+	reserved64 [2]uint64
+	flags      uint32
+	reserved   [3]uint32
+}
+
+type fiemapRequest struct {
+	header  fiemapHeader
+	extents [fiemapExtentBatch]fiemapExtent
+}
+
+// fileExtents lists where the data of the file lies on disk, in logical order
+// Holes aren't covered by any extent
+func fileExtents(file *os.File, size int64) ([]fileExtent, error) {
+	var extents []fileExtent
+	var request fiemapRequest
+	for start := uint64(0); start < uint64(size); {
+		request.header = fiemapHeader{start: start, length: uint64(size) - start, flags: fiemapFlagSync, extentCount: fiemapExtentBatch}
+		_, _, errno := unix.Syscall(unix.SYS_IOCTL, file.Fd(), fsIOCFiemap, uintptr(unsafe.Pointer(&request)))
+		if errno != 0 {
+			return nil, errno
+		}
+		mapped := request.extents[:request.header.mappedExtents]
+		if len(mapped) == 0 {
+			break
+		}
+		for _, extent := range mapped {
+			extents = append(extents, fileExtent{logical: int64(extent.logical), physical: int64(extent.physical), length: int64(extent.length)})
+		}
+		last := mapped[len(mapped)-1]
+		if last.flags&fiemapExtentLast != 0 {
+			break
+		}
+		start = last.logical + last.length
+	}
+	return extents, nil
+}
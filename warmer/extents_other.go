@@ -0,0 +1,12 @@
+//go:build !linux
+
+package warmer
+
+import (
+	"errors"
+	"os"
+)
+
+func fileExtents(file *os.File, size int64) ([]fileExtent, error) {
+	return nil, errors.New("finding extents is only supported on Linux")
+}
@@ -0,0 +1,69 @@
+package warmer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// writeTestFiles writes count small files and returns their paths
+func writeTestFiles(t *testing.T, count int) []string {
+	t.Helper()
+	dir := t.TempDir()
+	paths := make([]string, count)
+	for i := range paths {
+		paths[i] = writeTestFile(t, dir, fmt.Sprintf("file%d", i), 100+i%5000)
+	}
+	return paths
+}
+
+func openFiles(t *testing.T) int {
+	t.Helper()
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skipf("can't count open files: %v", err)
+	}
+	return len(entries)
+}
+
+func TestWarmClosesFiles(t *testing.T) {
+	paths := writeTestFiles(t, 2000)
+	before := openFiles(t)
+	result, err := Warm(context.Background(), paths, testOptions())
+	if err != nil {
+		t.Fatalf("Warm: %v", err)
+	}
+	if result.FileCount != len(paths) || result.FailedFiles != 0 {
+		t.Fatalf("Warm warmed %d files with %d failed, want %d without failures", result.FileCount, result.FailedFiles, len(paths))
+	}
+	if after := openFiles(t); after > before {
+		t.Fatalf("%d files open after Warm, %d before", after, before)
+	}
+}
+
+func TestWarmStaysBelowOpenFileLimit(t *testing.T) {
+	paths := writeTestFiles(t, 1000)
+
+	var limit unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &limit); err != nil {
+		t.Fatal(err)
+	}
+	// Far fewer descriptors than files, the default batch has to keep to half of them
+	lowered := limit
+	lowered.Cur = uint64(openFiles(t) + 64)
+	if err := unix.Setrlimit(unix.RLIMIT_NOFILE, &lowered); err != nil {
+		t.Skipf("can't lower the limit of open files: %v", err)
+	}
+	t.Cleanup(func() { unix.Setrlimit(unix.RLIMIT_NOFILE, &limit) })
+
+	result, err := Warm(context.Background(), paths, testOptions())
+	if err != nil {
+		t.Fatalf("Warm: %v", err)
+	}
+	if result.FileCount != len(paths) || result.FailedFiles != 0 {
+		t.Fatalf("Warm warmed %d files with %d failed, want %d without failures", result.FileCount, result.FailedFiles, len(paths))
+	}
+}
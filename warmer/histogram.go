@@ -0,0 +1,81 @@
+package warmer
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// Bucket i counts reads below 2^i microseconds, the last one also everything slower
+// Percentiles are the upper bound of their bucket, so at most twice the actual latency
+const latencyBuckets = 32
+
+// latencyHistogram counts read latencies in power of two buckets, cheap enough to record every read
+type latencyHistogram struct {
+	counts [latencyBuckets]int64
+	reads  int64
+	max    time.Duration
+}
+
+func (h *latencyHistogram) record(latency time.Duration) {
+	h.counts[min(bits.Len64(uint64(max(latency.Microseconds(), 0))), latencyBuckets-1)]++
+	h.reads++
+	h.max = max(h.max, latency)
+}
+
+func (h *latencyHistogram) merge(other *latencyHistogram) {
+	for i, count := range other.counts {
+		h.counts[i] += count
+	}
+	h.reads += other.reads
+	h.max = max(h.max, other.max)
+}
+
+// percentile returns the latency p (0 to 1) of the reads were at most as slow as
+func (h *latencyHistogram) percentile(p float64) time.Duration {
+	rank := int64(math.Ceil(p * float64(h.reads)))
+	var seen int64
+	for i, count := range h.counts {
+		seen += count
+		if seen >= rank && count > 0 {
+			return min(time.Duration(1<<i)*time.Microsecond, h.max)
+		}
+	}
+	return h.max
+}
+
+func (h *latencyHistogram) stats() LatencyStats {
+	milliseconds := func(latency time.Duration) float64 {
+		return float64(latency) / float64(time.Millisecond)
+	}
+	return LatencyStats{
+		Reads: h.reads,
+		P50Ms: milliseconds(h.percentile(0.50)),
+		P90Ms: milliseconds(h.percentile(0.90)),
+		P99Ms: milliseconds(h.percentile(0.99)),
+		MaxMs: milliseconds(h.max),
+	}
+}
+
+// latencyRecorder keeps the latencies a worker measured per file, without locking
+// A nil recorder records nothing, the histograms are only kept when asked for
+type latencyRecorder map[*fileProgress]*latencyHistogram
+
+func (r latencyRecorder) record(progress *fileProgress, latency time.Duration) {
+	if r == nil {
+		return
+	}
+	histogram, ok := r[progress]
+	if !ok {
+		histogram = &latencyHistogram{}
+		r[progress] = histogram
+	}
+	histogram.record(latency)
+}
+
+// flush merges the latencies into the files, once the worker is done
+func (r latencyRecorder) flush() {
+	for progress, histogram := range r {
+		progress.addLatencies(histogram)
+	}
+}
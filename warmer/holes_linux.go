@@ -0,0 +1,38 @@
+//go:build linux
+
+package warmer
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// dataBlocks reports which blocks of the file hold data, the others lie entirely in holes
+// Data extents are found with lseek SEEK_DATA and SEEK_HOLE, no data is read
+// https://man7.org/linux/man-pages/man2/lseek.2.html
+func dataBlocks(file *os.File, size int64, blockSize int64) ([]bool, error) {
+	fd := int(file.Fd())
+	data := make([]bool, (size+blockSize-1)/blockSize)
+	for offset := int64(0); offset < size; {
+		start, err := unix.Seek(fd, offset, unix.SEEK_DATA)
+		// ENXIO means there is no data after offset, only a hole up to the end
+		if errors.Is(err, unix.ENXIO) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		end, err := unix.Seek(fd, start, unix.SEEK_HOLE)
+		if err != nil {
+			return nil, err
+		}
+		end = min(end, size)
+		for block := start / blockSize; block*blockSize < end; block++ {
+			data[block] = true
+		}
+		offset = end
+	}
+	return data, nil
+}
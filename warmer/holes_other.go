@@ -0,0 +1,12 @@
+//go:build !linux
+
+package warmer
+
+import (
+	"errors"
+	"os"
+)
+
+func dataBlocks(file *os.File, size int64, blockSize int64) ([]bool, error) {
+	return nil, errors.New("finding holes is only supported on Linux")
+}
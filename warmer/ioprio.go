@@ -0,0 +1,35 @@
+package warmer
+
+import "fmt"
+
+// IOPriorityClass is an I/O scheduling class of ioprio_set(2)
+type IOPriorityClass int
+
+const (
+	// Leave the I/O priority of the workers unchanged
+	IOPriorityUnchanged IOPriorityClass = 0
+	// Scheduled with the other best effort I/O, Level 0 (highest) to 7 (lowest)
+	IOPriorityBestEffort IOPriorityClass = 2
+	// Only gets disk time when no other process needs it
+	IOPriorityIdle IOPriorityClass = 3
+)
+
+// IOPriority is the I/O scheduling priority the workers read with
+type IOPriority struct {
+	Class IOPriorityClass
+	// Only used with IOPriorityBestEffort
+	Level int
+}
+
+func (p IOPriority) validate() error {
+	switch p.Class {
+	case IOPriorityUnchanged, IOPriorityIdle:
+	case IOPriorityBestEffort:
+		if p.Level < 0 || p.Level > 7 {
+			return fmt.Errorf("best effort I/O priority level must be 0 to 7, got %d", p.Level)
+		}
+	default:
+		return fmt.Errorf("unknown I/O priority class %d", p.Class)
+	}
+	return checkIOPriority(p)
+}
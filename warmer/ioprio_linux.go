@@ -0,0 +1,33 @@
+//go:build linux
+
+package warmer
+
+import (
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+)
+
+// setThreadIOPriority sets the I/O priority of the thread the calling goroutine runs on
+// The goroutine stays locked to the thread, so no other goroutine inherits the priority
+// The thread exits with the goroutine, as it's never unlocked
+// https://man7.org/linux/man-pages/man2/ioprio_set.2.html
+func setThreadIOPriority(priority IOPriority) error {
+	runtime.LockOSThread()
+	// Who 0 with IOPRIO_WHO_PROCESS is the calling thread
+	prio := int(priority.Class)<<ioprioClassShift | priority.Level
+	_, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, 0, uintptr(prio))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func checkIOPriority(priority IOPriority) error {
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package warmer
+
+import "errors"
+
+var errIOPriorityUnsupported = errors.New("setting the I/O priority is only supported on Linux")
+
+func setThreadIOPriority(priority IOPriority) error {
+	return errIOPriorityUnsupported
+}
+
+func checkIOPriority(priority IOPriority) error {
+	if priority.Class == IOPriorityUnchanged {
+		return nil
+	}
+	return errIOPriorityUnsupported
+}
@@ -0,0 +1,193 @@
+//go:build linux
+
+package warmer
+
+import (
+	"errors"
+	"io"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/iceber/iouring-go"
+	iouring_syscall "github.com/iceber/iouring-go/syscall"
+)
+
+// Number of reads submitted to the ring at once
+const ioUringBatchSize = 64
+
+// Upper bound of registered buffer memory per ring
+// Reads of a batch share the buffers round robin once it's reached, the data is thrown away anyway
+const ioUringBufferBudget int64 = 16 * 1024 * 1024 // 16MB
+
+// ioUringBatch collects reads and submits them to the ring together
+type ioUringBatch struct {
+	iour      *iouring.IOURing
+	buffers   [][]byte
+	blockSize int64
+	fixed     bool
+	requests  []iouring.PrepRequest
+	// File each queued read belongs to, bytes are accounted to it on completion
+	progresses []*fileProgress
+	// Failed reads are retried with pread, the ring is shared by the whole batch
+	retries int
+	logger  *Logger
+	// The reads of a batch complete together, each is recorded with the time the whole batch took
+	latencies latencyRecorder
+}
+
+// ioUringRead is attached to every request, to know what to retry when it fails
+type ioUringRead struct {
+	progress *fileProgress
+	offset   int64
+}
+
+// probeIOUring checks if the kernel supports io_uring at all
+func probeIOUring() error {
+	iour, err := iouring.New(1)
+	if err != nil {
+		return err
+	}
+	return iour.Close()
+}
+
+func newIOUringBatch(blockSize int64, retries int, logger *Logger) (*ioUringBatch, error) {
+	iour, err := iouring.New(ioUringBatchSize + 4) // Keep some extra space
+	if err != nil {
+		return nil, err
+	}
+
+	buffers := make([][]byte, ioUringBuffers(blockSize))
+	for i := range buffers {
+		buffers[i] = alignedBuffer(blockSize)
+	}
+
+	// Registered buffers save the kernel from mapping them on every read
+	// Can fail on older kernels or with a low RLIMIT_MEMLOCK, plain reads work there too
+	fixed := iour.RegisterBuffers(buffers) == nil
+
+	return &ioUringBatch{
+		iour:       iour,
+		buffers:    buffers,
+		blockSize:  blockSize,
+		fixed:      fixed,
+		requests:   make([]iouring.PrepRequest, 0, ioUringBatchSize),
+		progresses: make([]*fileProgress, 0, ioUringBatchSize),
+		retries:    retries,
+		logger:     logger,
+	}, nil
+}
+
+// add queues a read and submits the batch once it's full
+func (b *ioUringBatch) add(fd int, offset int64, progress *fileProgress) error {
+	index := len(b.requests) % len(b.buffers)
+	b.requests = append(b.requests, pread(fd, b.buffers[index], offset, b.fixed, uint16(index), progress))
+	b.progresses = append(b.progresses, progress)
+	if len(b.requests) < ioUringBatchSize {
+		return nil
+	}
+	return b.submit()
+}
+
+// submit sends the queued reads and waits for all of them to complete
+func (b *ioUringBatch) submit() error {
+	if len(b.requests) == 0 {
+		return nil
+	}
+	defer func() {
+		b.requests = b.requests[:0]
+		b.progresses = b.progresses[:0]
+	}()
+
+	submitted := time.Now()
+	request, err := b.iour.SubmitRequests(b.requests, nil)
+	if err != nil {
+		for _, progress := range b.progresses {
+			progress.fail(err)
+			progress.complete(1, 0)
+		}
+		return err
+	}
+	<-request.Done()
+	latency := time.Since(submitted)
+	for _, progress := range b.progresses {
+		b.latencies.record(progress, latency)
+	}
+	completeRequests(request, b.retries, b.logger)
+	return nil
+}
+
+// reset drops the reads queued but not submitted, e.g. for files given up on
+func (b *ioUringBatch) reset() {
+	b.requests = b.requests[:0]
+	b.progresses = b.progresses[:0]
+}
+
+func (b *ioUringBatch) close() error {
+	return b.iour.Close()
+}
+
+// ioUringBuffers is the number of buffers registered with a ring
+func ioUringBuffers(blockSize int64) int64 {
+	return max(1, min(int64(ioUringBatchSize), ioUringBufferBudget/blockSize))
+}
+
+// ioUringBufferMemory is the memory of the buffers of a ring
+func ioUringBufferMemory(blockSize int64) int64 {
+	return ioUringBuffers(blockSize) * blockSize
+}
+
+// pread prepares a read tagged with the file it belongs to
+// With fixed, the buffer must be the one registered with the ring at bufIndex
+func pread(fd int, buffer []byte, offset int64, fixed bool, bufIndex uint16, progress *fileProgress) iouring.PrepRequest {
+	return func(sqe iouring_syscall.SubmissionQueueEntry, userData *iouring.UserData) {
+		userData.SetRequestBuffer(buffer, nil)
+		userData.SetRequestInfo(&ioUringRead{progress: progress, offset: offset})
+
+		opcode := uint8(iouring_syscall.IORING_OP_READ)
+		if fixed {
+			opcode = iouring_syscall.IORING_OP_READ_FIXED
+		}
+		sqe.PrepOperation(
+			opcode,
+			int32(fd),
+			uint64(uintptr(unsafe.Pointer(&buffer[0]))),
+			uint32(len(buffer)),
+			uint64(offset),
+		)
+		if fixed {
+			sqe.SetBufIndex(bufIndex)
+		}
+	}
+}
+
+// completeRequests accounts the bytes read by each request of a batch to its file
+// Failed requests report a negative errno as result, transient failures are read again with pread
+// Retries stop once the context of the file is done
+func completeRequests(requests iouring.RequestSet, retries int, logger *Logger) {
+	for _, request := range requests.Requests() {
+		read := request.GetRequestInfo().(*ioUringRead)
+		n, _ := request.GetRes()
+		var err error
+		if n < 0 {
+			err = syscall.Errno(-n)
+			n = 0
+			if isTransientReadError(err) && retries > 0 || errors.Is(err, syscall.EINTR) {
+				buffer, _ := request.GetRequestBuffer()
+				logger.Debugf("Retrying read at offset %d of %s with pread: %v\n", read.offset, read.progress.path, err)
+				n, err = readWithRetries(read.progress.ctx, max(retries-1, 0), logger, read.progress.path, read.offset, func() (int, error) {
+					return preadFull(fileReader(request.Fd()), buffer, read.offset)
+				})
+			}
+		}
+		if err != nil && err != io.EOF {
+			if read.progress.failBlock(read.offset, err) {
+				logger.Errorf("Error reading block at offset %d of %s: %v\n", read.offset, read.progress.path, err)
+			}
+		} else {
+			read.progress.readBlock()
+			evictRead(read.progress, request.Fd(), read.offset, int64(n), logger)
+		}
+		read.progress.complete(1, int64(n))
+	}
+}
@@ -0,0 +1,40 @@
+//go:build !linux
+
+package warmer
+
+import "errors"
+
+var errIOUringUnsupported = errors.New("io_uring is only supported on Linux")
+
+type ioUringBatch struct {
+	blockSize int64
+	retries   int
+	logger    *Logger
+	latencies latencyRecorder
+}
+
+func probeIOUring() error {
+	return errIOUringUnsupported
+}
+
+func newIOUringBatch(blockSize int64, retries int, logger *Logger) (*ioUringBatch, error) {
+	return nil, errIOUringUnsupported
+}
+
+func ioUringBufferMemory(blockSize int64) int64 {
+	return 0
+}
+
+func (b *ioUringBatch) add(fd int, offset int64, progress *fileProgress) error {
+	return nil
+}
+
+func (b *ioUringBatch) submit() error {
+	return nil
+}
+
+func (b *ioUringBatch) reset() {}
+
+func (b *ioUringBatch) close() error {
+	return nil
+}
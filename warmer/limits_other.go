@@ -0,0 +1,7 @@
+//go:build !linux && !darwin
+
+package warmer
+
+func defaultOpenBatch() int {
+	return fallbackOpenBatch
+}
@@ -0,0 +1,14 @@
+//go:build linux || darwin
+
+package warmer
+
+import "golang.org/x/sys/unix"
+
+// defaultOpenBatch stays at half the soft limit of open files, the rest is left for rings, sockets and the caller
+func defaultOpenBatch() int {
+	var limit unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &limit); err != nil {
+		return fallbackOpenBatch
+	}
+	return int(max(min(limit.Cur/2, maxOpenBatch), 1))
+}
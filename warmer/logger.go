@@ -0,0 +1,51 @@
+package warmer
+
+import (
+	"fmt"
+	"io"
+	"log"
+)
+
+// Level is the minimum level of the messages a Logger writes
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// Logger drops messages below its level
+// Messages keep the format of the standard logger, the level isn't printed
+type Logger struct {
+	out   *log.Logger
+	level Level
+}
+
+func NewLogger(w io.Writer, level Level) *Logger {
+	return &Logger{out: log.New(w, "", log.LstdFlags), level: level}
+}
+
+func (l *Logger) logf(level Level, format string, args ...any) {
+	if level < l.level {
+		return
+	}
+	l.out.Output(3, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Debugf(format string, args ...any) {
+	l.logf(LevelDebug, format, args...)
+}
+
+func (l *Logger) Infof(format string, args ...any) {
+	l.logf(LevelInfo, format, args...)
+}
+
+func (l *Logger) Warnf(format string, args ...any) {
+	l.logf(LevelWarn, format, args...)
+}
+
+func (l *Logger) Errorf(format string, args ...any) {
+	l.logf(LevelError, format, args...)
+}
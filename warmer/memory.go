@@ -0,0 +1,59 @@
+package warmer
+
+import "fmt"
+
+// workerMemory is the buffer memory a worker holds for as long as it runs
+// Every worker reads into its own blocksPerRead buffers of blockSize, with io_uring the ring has buffers of its own
+// Buffers aren't pooled or grown, so the peak of a group is exactly its workers times this, per file warmed at once
+func workerMemory(method FileIOMethod, blockSize int64, blocksPerRead int) int64 {
+	memory := int64(blocksPerRead) * blockSize
+	if method == IOUring {
+		memory += ioUringBufferMemory(blockSize)
+	}
+	return memory
+}
+
+// bufferMemory is the peak buffer memory of warming with opts, both groups run at the same time
+func bufferMemory(opts Options) int64 {
+	if !blockMethods[opts.Method] {
+		return 0
+	}
+	small := int64(opts.SmallFilesWorkerCount) * workerMemory(opts.Method, opts.BlockSizeForSmallFiles, opts.readBlocks(opts.BlockSizeForSmallFiles))
+	large := int64(opts.LargeFilesWorkerCount) * workerMemory(opts.Method, opts.BlockSizeForLargeFiles, opts.readBlocks(opts.BlockSizeForLargeFiles))
+	return int64(opts.FileConcurrency) * (small + large)
+}
+
+// capMemory lowers the worker counts of opts until the buffer memory fits in opts.MaxMemory
+// Both groups keep at least one worker, it fails when even that doesn't fit, unless MaxMemoryBestEffort is set
+func capMemory(opts *Options, logger *Logger) error {
+	if opts.MaxMemory == 0 {
+		return nil
+	}
+	if memory := bufferMemory(*opts); memory <= opts.MaxMemory {
+		logger.Debugf("Buffers take %d bytes, below the cap of %d bytes\n", memory, opts.MaxMemory)
+		return nil
+	}
+	smallWorkers, largeWorkers := opts.SmallFilesWorkerCount, opts.LargeFilesWorkerCount
+	opts.SmallFilesWorkerCount, opts.LargeFilesWorkerCount = 1, 1
+	if memory := bufferMemory(*opts); memory > opts.MaxMemory {
+		if opts.MaxMemoryBestEffort {
+			logger.Warnf("Reducing workers from %d to 1 for small files and from %d to 1 for large files, their buffers still take %d bytes, above the cap of %d bytes\n", smallWorkers, largeWorkers, memory, opts.MaxMemory)
+			return nil
+		}
+		return fmt.Errorf("max memory of %d bytes is too low, a single worker per group needs %d bytes with these block sizes", opts.MaxMemory, memory)
+	}
+
+	// Take workers away from the larger group first, it usually has the larger blocks too
+	opts.SmallFilesWorkerCount, opts.LargeFilesWorkerCount = smallWorkers, largeWorkers
+	for bufferMemory(*opts) > opts.MaxMemory {
+		if opts.LargeFilesWorkerCount > 1 && opts.LargeFilesWorkerCount >= opts.SmallFilesWorkerCount {
+			opts.LargeFilesWorkerCount--
+		} else if opts.SmallFilesWorkerCount > 1 {
+			opts.SmallFilesWorkerCount--
+		} else {
+			opts.LargeFilesWorkerCount--
+		}
+	}
+	logger.Infof("Reducing workers from %d to %d for small files and from %d to %d for large files to stay below %d bytes of buffers\n", smallWorkers, opts.SmallFilesWorkerCount, largeWorkers, opts.LargeFilesWorkerCount, opts.MaxMemory)
+	return nil
+}
@@ -0,0 +1,53 @@
+package warmer
+
+import (
+	"io"
+	"testing"
+)
+
+func TestCapMemoryBelowOneWorkerPerGroup(t *testing.T) {
+	logger := NewLogger(io.Discard, LevelError)
+	opts := Options{
+		Method:                 PosixSync,
+		BlockSizeForSmallFiles: 1 << 20,
+		BlockSizeForLargeFiles: 1 << 20,
+		SmallFilesWorkerCount:  2,
+		LargeFilesWorkerCount:  8,
+		BlocksPerRead:          1,
+		FileConcurrency:        1,
+		MaxMemory:              1 << 20,
+	}
+
+	strict := opts
+	if err := capMemory(&strict, logger); err == nil {
+		t.Fatalf("capMemory with %d bytes for 2MB of buffers: expected an error", strict.MaxMemory)
+	}
+
+	bestEffort := opts
+	bestEffort.MaxMemoryBestEffort = true
+	if err := capMemory(&bestEffort, logger); err != nil {
+		t.Fatalf("capMemory with MaxMemoryBestEffort: %v", err)
+	}
+	if bestEffort.SmallFilesWorkerCount != 1 || bestEffort.LargeFilesWorkerCount != 1 {
+		t.Fatalf("capMemory with MaxMemoryBestEffort left %d small and %d large workers, want 1 and 1", bestEffort.SmallFilesWorkerCount, bestEffort.LargeFilesWorkerCount)
+	}
+}
+
+func TestCapMemoryLowersLargeWorkersFirst(t *testing.T) {
+	opts := Options{
+		Method:                 PosixSync,
+		BlockSizeForSmallFiles: 1 << 20,
+		BlockSizeForLargeFiles: 1 << 20,
+		SmallFilesWorkerCount:  2,
+		LargeFilesWorkerCount:  8,
+		BlocksPerRead:          1,
+		FileConcurrency:        1,
+		MaxMemory:              6 << 20,
+	}
+	if err := capMemory(&opts, NewLogger(io.Discard, LevelError)); err != nil {
+		t.Fatalf("capMemory: %v", err)
+	}
+	if opts.SmallFilesWorkerCount != 2 || opts.LargeFilesWorkerCount != 4 {
+		t.Fatalf("capMemory left %d small and %d large workers, want 2 and 4", opts.SmallFilesWorkerCount, opts.LargeFilesWorkerCount)
+	}
+}
@@ -0,0 +1,39 @@
+package warmer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// Files are mapped this much at a time, so huge files don't need a huge mapping
+// Must stay a multiple of the page size
+const mmapWindowSize int64 = 1024 * 1024 * 1024 // 1GB
+
+// The context is checked after touching this many bytes, a window takes a while to populate from slow storage
+const populateCheckSize = 64 * 1024 * 1024
+
+// touchPages reads one byte of every page of a mapping, which blocks until the page is in page cache
+// A file truncated meanwhile faults past its new end, that becomes an error instead of crashing
+func touchPages(ctx context.Context, data []byte) (err error) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("populating mapping: %v", r)
+		}
+	}()
+
+	pageSize := os.Getpagesize()
+	var sum byte
+	for i := 0; i < len(data); i += pageSize {
+		if i%populateCheckSize == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		sum += data[i]
+	}
+	// The bytes touched aren't needed, only the loads are
+	runtime.KeepAlive(sum)
+	return nil
+}
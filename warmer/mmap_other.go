@@ -0,0 +1,13 @@
+//go:build !unix
+
+package warmer
+
+import (
+	"context"
+	"errors"
+	"os"
+)
+
+func madviseWillNeed(ctx context.Context, file *os.File, size int64, populate bool) error {
+	return errors.New("the mmap method is only supported on Unix")
+}
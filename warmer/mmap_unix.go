@@ -0,0 +1,41 @@
+//go:build unix
+
+package warmer
+
+import (
+	"context"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// madviseWillNeed maps the file window by window and asks the kernel to prefetch each one
+// MADV_SEQUENTIAL goes first, so the kernel reads ahead aggressively, e.g. while populating
+// With populate one byte per page is touched too, some kernels and filesystems defer the fetch of MADV_WILLNEED
+// https://man7.org/linux/man-pages/man2/madvise.2.html
+func madviseWillNeed(ctx context.Context, file *os.File, size int64, populate bool) error {
+	fd := int(file.Fd())
+	for offset := int64(0); offset < size; offset += mmapWindowSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		length := min(mmapWindowSize, size-offset)
+		data, err := unix.Mmap(fd, offset, int(length), unix.PROT_READ, unix.MAP_SHARED)
+		if err != nil {
+			return err
+		}
+		err = unix.Madvise(data, unix.MADV_SEQUENTIAL)
+		if err == nil {
+			err = unix.Madvise(data, unix.MADV_WILLNEED)
+		}
+		if err == nil && populate {
+			err = touchPages(ctx, data)
+		}
+		unix.Munmap(data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
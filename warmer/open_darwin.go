@@ -0,0 +1,43 @@
+//go:build darwin
+
+package warmer
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// macOS has no O_DIRECT, F_NOCACHE is the closest equivalent
+// Reads of the file bypass the unified buffer cache
+func openFileForWarmup(path string) (*os.File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := unix.FcntlInt(file.Fd(), unix.F_NOCACHE, 1); err != nil {
+		file.Close()
+		return nil, &os.PathError{Op: "fcntl F_NOCACHE", Path: path, Err: err}
+	}
+	return file, nil
+}
+
+// directUnsupported tells if F_NOCACHE was refused by the filesystem, EINVAL like O_DIRECT on Linux
+func directUnsupported(err error) bool {
+	return errors.Is(err, unix.EINVAL)
+}
+
+// Nothing to drop, F_NOCACHE already keeps the file out of the cache
+func dropPageCache(fd int) error {
+	return nil
+}
+
+func dropPageCacheRange(fd int, offset int64, length int64) error {
+	return nil
+}
+
+// Nothing is read through the cache that readahead could be tuned for
+func adviseAccessPattern(fd int, hint FadviseHint) error {
+	return nil
+}
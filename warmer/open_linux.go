@@ -0,0 +1,49 @@
+//go:build linux
+
+package warmer
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Open file with O_DIRECT and O_RDONLY
+// To prevent going through disk cache + prevent modification to file
+// Disk cache is useless as on the system free memory will be less
+// And reading large file will add/remove cache and slow down system and the whole process
+func openFileForWarmup(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDONLY|syscall.O_DIRECT, 0)
+}
+
+// directUnsupported tells if the open failed as the filesystem doesn't support O_DIRECT
+// Some, e.g. some FUSE mounts, refuse the open with EINVAL
+func directUnsupported(err error) bool {
+	return errors.Is(err, unix.EINVAL)
+}
+
+// Tell the kernel to not cache the file
+// Avoid high memory usage during the block reads
+// https://man7.org/linux/man-pages/man2/posix_fadvise.2.html
+func dropPageCache(fd int) error {
+	return unix.Fadvise(fd, 0, 0, unix.FADV_DONTNEED)
+}
+
+// Drop just the pages of a range from page cache, once it was read
+func dropPageCacheRange(fd int, offset int64, length int64) error {
+	return unix.Fadvise(fd, offset, length, unix.FADV_DONTNEED)
+}
+
+// Tell the kernel how the file is going to be read, to tune readahead
+func adviseAccessPattern(fd int, hint FadviseHint) error {
+	advice := unix.FADV_NORMAL
+	switch hint {
+	case HintSequential:
+		advice = unix.FADV_SEQUENTIAL
+	case HintRandom:
+		advice = unix.FADV_RANDOM
+	}
+	return unix.Fadvise(fd, 0, 0, advice)
+}
@@ -0,0 +1,27 @@
+//go:build !linux && !darwin
+
+package warmer
+
+import "os"
+
+// No way to bypass the page cache here, fall back to plain buffered reads
+func openFileForWarmup(path string) (*os.File, error) {
+	return os.Open(path)
+}
+
+// Nothing is opened differently, so nothing can be refused
+func directUnsupported(err error) bool {
+	return false
+}
+
+func dropPageCache(fd int) error {
+	return nil
+}
+
+func dropPageCacheRange(fd int, offset int64, length int64) error {
+	return nil
+}
+
+func adviseAccessPattern(fd int, hint FadviseHint) error {
+	return nil
+}
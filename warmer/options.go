@@ -0,0 +1,183 @@
+package warmer
+
+import (
+	"errors"
+	"fmt"
+)
+
+// setDefaults fills in the optional fields left empty
+func (opts *Options) setDefaults() {
+	if opts.Order == "" {
+		opts.Order = OrderInput
+	}
+	if opts.Dispatch == "" {
+		opts.Dispatch = DispatchSequential
+	}
+	if opts.BlocksPerRead == 0 {
+		opts.BlocksPerRead = 1
+	}
+	if opts.FileConcurrency == 0 {
+		opts.FileConcurrency = 1
+	}
+	if opts.FadviseHint == "" {
+		opts.FadviseHint = HintSequential
+	}
+	if opts.Pattern == "" {
+		opts.Pattern = PatternSequential
+	}
+}
+
+// Validate checks opts the way Warm does before anything is opened
+// Optional fields may be left empty, the error describes the first invalid one
+func (opts Options) Validate() error {
+	opts.setDefaults()
+
+	if _, ok := lookupBackend(opts.Method); !ok && !blockMethods[opts.Method] {
+		return fmt.Errorf("unknown method %q", opts.Method)
+	}
+	for _, blockSize := range []int64{opts.BlockSizeForSmallFiles, opts.BlockSizeForLargeFiles} {
+		if err := ValidateBlockSize(blockSize); err != nil {
+			return fmt.Errorf("invalid block size: %w", err)
+		}
+	}
+	switch opts.Order {
+	case OrderInput, OrderSizeDesc:
+	default:
+		return fmt.Errorf("unknown order %q", opts.Order)
+	}
+	switch opts.Dispatch {
+	case DispatchSequential, DispatchInterleave, DispatchWeighted:
+	default:
+		return fmt.Errorf("unknown dispatch mode %q", opts.Dispatch)
+	}
+	if opts.BlocksPerRead < 1 {
+		return fmt.Errorf("invalid blocks per read: %d", opts.BlocksPerRead)
+	}
+	if opts.FileConcurrency < 1 {
+		return fmt.Errorf("invalid file concurrency: %d", opts.FileConcurrency)
+	}
+	switch opts.FadviseHint {
+	case HintSequential, HintRandom, HintNormal:
+	default:
+		return fmt.Errorf("unknown fadvise hint %q", opts.FadviseHint)
+	}
+	if opts.OpenBatch < 0 {
+		return fmt.Errorf("invalid open batch: %d", opts.OpenBatch)
+	}
+	if opts.PerDiskConcurrency < 0 {
+		return fmt.Errorf("invalid per disk concurrency: %d", opts.PerDiskConcurrency)
+	}
+	if opts.WorkersPerDisk < 0 {
+		return fmt.Errorf("invalid workers per disk: %d", opts.WorkersPerDisk)
+	}
+	if opts.WorkersPerDisk > 0 && !blockMethods[opts.Method] {
+		return fmt.Errorf("workers per disk don't work with the %s method", opts.Method)
+	}
+	// The pools are only known once the files are opened, too late to size them to the memory
+	if opts.WorkersPerDisk > 0 && opts.MaxMemory > 0 {
+		return errors.New("workers per disk can't be combined with a max memory")
+	}
+	// Verifying needs the data of every block in userspace
+	if opts.Checksums != nil && opts.Method != PosixSync {
+		return fmt.Errorf("verifying checksums requires the %s method, got %q", PosixSync, opts.Method)
+	}
+	if opts.Checksums != nil && opts.SkipCached {
+		return errors.New("verifying checksums can't skip cached blocks")
+	}
+	if opts.Checksums != nil && opts.SkipHoles {
+		return errors.New("verifying checksums can't skip holes")
+	}
+	switch opts.Pattern {
+	case PatternSequential, PatternRandom:
+	default:
+		return fmt.Errorf("unknown read pattern %q", opts.Pattern)
+	}
+	if opts.Pattern == PatternRandom && !blockMethods[opts.Method] {
+		return fmt.Errorf("the random pattern doesn't work with the %s method", opts.Method)
+	}
+	if opts.Pattern == PatternRandom && (opts.Stride || opts.PhysicalOrder) {
+		return errors.New("the random pattern can't be combined with stride or physical order")
+	}
+	if opts.Stride && !blockMethods[opts.Method] {
+		return fmt.Errorf("stride doesn't work with the %s method", opts.Method)
+	}
+	// Blocks arriving out of order are buffered until the hash gets to them, far out of order that's most of the file
+	if opts.Checksums != nil && (opts.Stride || opts.PhysicalOrder || opts.Pattern == PatternRandom) {
+		return errors.New("verifying checksums needs blocks read in order, it can't be combined with stride, physical order or the random pattern")
+	}
+	// Both pick the order blocks are read in
+	if opts.Stride && opts.PhysicalOrder {
+		return errors.New("stride can't be combined with physical order")
+	}
+	// Only psync reads the blocks itself, one by one
+	if opts.TouchOnly && opts.Method != PosixSync {
+		return fmt.Errorf("touching blocks requires the %s method, got %q", PosixSync, opts.Method)
+	}
+	if opts.TouchOnly && (opts.Checksums != nil || opts.Adaptive) {
+		return errors.New("touching blocks reads too little to verify checksums or tune the read size")
+	}
+	// readahead returns before the pages are read, dropping them right away would undo it
+	if opts.EvictAfter && opts.Method != PosixSync && opts.Method != IOUring {
+		return fmt.Errorf("evicting after reading requires the %s or %s method, got %q", PosixSync, IOUring, opts.Method)
+	}
+	if opts.MmapPopulate && opts.Method != Mmap {
+		return fmt.Errorf("populating mappings requires the %s method, got %q", Mmap, opts.Method)
+	}
+	if opts.Adaptive && !blockMethods[opts.Method] {
+		return fmt.Errorf("adaptive read sizes don't work with the %s method", opts.Method)
+	}
+	if opts.SkipHoles && !blockMethods[opts.Method] {
+		return fmt.Errorf("skipping holes doesn't work with the %s method", opts.Method)
+	}
+	if opts.Head < 0 {
+		return fmt.Errorf("invalid head: %d", opts.Head)
+	}
+	if opts.Tail < 0 {
+		return fmt.Errorf("invalid tail: %d", opts.Tail)
+	}
+	if (len(opts.Ranges) > 0 || opts.Head > 0 || opts.Tail > 0) && !blockMethods[opts.Method] {
+		return fmt.Errorf("byte ranges can't be warmed with the %s method", opts.Method)
+	}
+	// Checksums of files without a range cover the whole file
+	if opts.Checksums != nil && opts.Head > 0 {
+		return errors.New("verifying checksums can't be combined with a head")
+	}
+	if opts.Checksums != nil && opts.Tail > 0 {
+		return errors.New("verifying checksums can't be combined with a tail")
+	}
+	for path, byteRange := range opts.Ranges {
+		if byteRange.Offset < 0 || byteRange.Length < 0 {
+			return fmt.Errorf("invalid byte range of %s: offset %d, length %d", path, byteRange.Offset, byteRange.Length)
+		}
+	}
+	if opts.Retries < 0 {
+		return fmt.Errorf("invalid retries: %d", opts.Retries)
+	}
+	if opts.MaxRate < 0 {
+		return fmt.Errorf("invalid max rate: %d", opts.MaxRate)
+	}
+	if opts.MaxMemory < 0 {
+		return fmt.Errorf("invalid max memory: %d", opts.MaxMemory)
+	}
+	if err := opts.IOPriority.validate(); err != nil {
+		return fmt.Errorf("invalid I/O priority: %w", err)
+	}
+	if opts.PinCPUs && !blockMethods[opts.Method] {
+		return fmt.Errorf("pinning workers to CPUs doesn't work with the %s method", opts.Method)
+	}
+	if opts.PinCPUs {
+		if err := checkCPUPinning(); err != nil {
+			return err
+		}
+	}
+	if opts.MaxFileErrors < 0 {
+		return fmt.Errorf("invalid max file errors: %d", opts.MaxFileErrors)
+	}
+	if opts.FileTimeout < 0 {
+		return fmt.Errorf("invalid file timeout: %v", opts.FileTimeout)
+	}
+	if opts.SmallFilesWorkerCount < 1 || opts.LargeFilesWorkerCount < 1 {
+		return fmt.Errorf("invalid worker count: need at least 1 worker, got %d (small files) and %d (large files)", opts.SmallFilesWorkerCount, opts.LargeFilesWorkerCount)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package warmer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateAcceptsDefaults(t *testing.T) {
+	if err := testOptions().Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	checksums := map[string][]byte{"/data/a": make([]byte, 32)}
+	tests := []struct {
+		name   string
+		modify func(*Options)
+		want   string
+	}{
+		{"unknown method", func(o *Options) { o.Method = "dma" }, `unknown method "dma"`},
+		{"block size of small files", func(o *Options) { o.BlockSizeForSmallFiles = 1000 }, "invalid block size"},
+		{"block size of large files", func(o *Options) { o.BlockSizeForLargeFiles = 0 }, "invalid block size"},
+		{"order", func(o *Options) { o.Order = "name" }, `unknown order "name"`},
+		{"dispatch", func(o *Options) { o.Dispatch = "random" }, `unknown dispatch mode "random"`},
+		{"blocks per read", func(o *Options) { o.BlocksPerRead = -1 }, "invalid blocks per read: -1"},
+		{"file concurrency", func(o *Options) { o.FileConcurrency = -1 }, "invalid file concurrency: -1"},
+		{"fadvise hint", func(o *Options) { o.FadviseHint = "dontneed" }, `unknown fadvise hint "dontneed"`},
+		{"open batch", func(o *Options) { o.OpenBatch = -1 }, "invalid open batch: -1"},
+		{"per disk concurrency", func(o *Options) { o.PerDiskConcurrency = -1 }, "invalid per disk concurrency: -1"},
+		{"workers per disk", func(o *Options) { o.WorkersPerDisk = -1 }, "invalid workers per disk: -1"},
+		{"workers per disk with a backend", func(o *Options) { o.WorkersPerDisk, o.Method = 2, Mmap }, "workers per disk don't work with the mmap method"},
+		{"workers per disk with max memory", func(o *Options) { o.WorkersPerDisk, o.MaxMemory = 2, 1<<30 }, "workers per disk can't be combined with a max memory"},
+		{"checksums with io_uring", func(o *Options) { o.Checksums, o.Method = checksums, IOUring }, "verifying checksums requires the psync method"},
+		{"checksums skipping cached blocks", func(o *Options) { o.Checksums, o.SkipCached = checksums, true }, "verifying checksums can't skip cached blocks"},
+		{"checksums skipping holes", func(o *Options) { o.Checksums, o.SkipHoles = checksums, true }, "verifying checksums can't skip holes"},
+		{"pattern", func(o *Options) { o.Pattern = "reverse" }, `unknown read pattern "reverse"`},
+		{"random pattern with a backend", func(o *Options) { o.Pattern, o.Method = PatternRandom, WillNeed }, "the random pattern doesn't work with the willneed method"},
+		{"random pattern with stride", func(o *Options) { o.Pattern, o.Stride = PatternRandom, true }, "the random pattern can't be combined with stride or physical order"},
+		{"random pattern in physical order", func(o *Options) { o.Pattern, o.PhysicalOrder = PatternRandom, true }, "the random pattern can't be combined with stride or physical order"},
+		{"stride with a backend", func(o *Options) { o.Stride, o.Method = true, Mmap }, "stride doesn't work with the mmap method"},
+		{"checksums with stride", func(o *Options) { o.Checksums, o.Stride = checksums, true }, "verifying checksums needs blocks read in order"},
+		{"checksums in physical order", func(o *Options) { o.Checksums, o.PhysicalOrder = checksums, true }, "verifying checksums needs blocks read in order"},
+		{"stride in physical order", func(o *Options) { o.Stride, o.PhysicalOrder = true, true }, "stride can't be combined with physical order"},
+		{"touching blocks with io_uring", func(o *Options) { o.TouchOnly, o.Method = true, IOUring }, "touching blocks requires the psync method"},
+		{"touching blocks with checksums", func(o *Options) { o.TouchOnly, o.Checksums = true, checksums }, "touching blocks reads too little"},
+		{"touching blocks with adaptive reads", func(o *Options) { o.TouchOnly, o.Adaptive = true, true }, "touching blocks reads too little"},
+		{"evicting after readahead", func(o *Options) { o.EvictAfter, o.Method = true, ReadAhead }, "evicting after reading requires the psync or io_uring method"},
+		{"populating without mmap", func(o *Options) { o.MmapPopulate = true }, "populating mappings requires the mmap method"},
+		{"adaptive reads with a backend", func(o *Options) { o.Adaptive, o.Method = true, Mmap }, "adaptive read sizes don't work with the mmap method"},
+		{"skipping holes with a backend", func(o *Options) { o.SkipHoles, o.Method = true, WillNeed }, "skipping holes doesn't work with the willneed method"},
+		{"head", func(o *Options) { o.Head = -1 }, "invalid head: -1"},
+		{"tail", func(o *Options) { o.Tail = -1 }, "invalid tail: -1"},
+		{"head with a backend", func(o *Options) { o.Head, o.Method = 4096, Mmap }, "byte ranges can't be warmed with the mmap method"},
+		{"ranges with a backend", func(o *Options) { o.Ranges, o.Method = map[string]ByteRange{"/data/a": {Length: 10}}, WillNeed }, "byte ranges can't be warmed with the willneed method"},
+		{"checksums with a head", func(o *Options) { o.Checksums, o.Head = checksums, 4096 }, "verifying checksums can't be combined with a head"},
+		{"checksums with a tail", func(o *Options) { o.Checksums, o.Tail = checksums, 4096 }, "verifying checksums can't be combined with a tail"},
+		{"range offset", func(o *Options) { o.Ranges = map[string]ByteRange{"/data/a": {Offset: -1}} }, "invalid byte range of /data/a"},
+		{"range length", func(o *Options) { o.Ranges = map[string]ByteRange{"/data/a": {Length: -1}} }, "invalid byte range of /data/a"},
+		{"retries", func(o *Options) { o.Retries = -1 }, "invalid retries: -1"},
+		{"max rate", func(o *Options) { o.MaxRate = -1 }, "invalid max rate: -1"},
+		{"max memory", func(o *Options) { o.MaxMemory = -1 }, "invalid max memory: -1"},
+		{"I/O priority class", func(o *Options) { o.IOPriority = IOPriority{Class: 9} }, "invalid I/O priority: unknown I/O priority class 9"},
+		{"I/O priority level", func(o *Options) { o.IOPriority = IOPriority{Class: IOPriorityBestEffort, Level: 8} }, "invalid I/O priority: best effort I/O priority level must be 0 to 7"},
+		{"pinning with a backend", func(o *Options) { o.PinCPUs, o.Method = true, Mmap }, "pinning workers to CPUs doesn't work with the mmap method"},
+		{"max file errors", func(o *Options) { o.MaxFileErrors = -1 }, "invalid max file errors: -1"},
+		{"file timeout", func(o *Options) { o.FileTimeout = -1 }, "invalid file timeout"},
+		{"small file workers", func(o *Options) { o.SmallFilesWorkerCount = 0 }, "invalid worker count"},
+		{"large file workers", func(o *Options) { o.LargeFilesWorkerCount = 0 }, "invalid worker count"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := testOptions()
+			test.modify(&opts)
+			err := opts.Validate()
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("Validate = %v, want an error with %q", err, test.want)
+			}
+		})
+	}
+}
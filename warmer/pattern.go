@@ -0,0 +1,79 @@
+package warmer
+
+import (
+	"hash/fnv"
+	"math/bits"
+)
+
+// ReadPattern is the order the blocks of a file are read in, see Options.Pattern
+type ReadPattern string
+
+const (
+	// Read the blocks of a file by offset
+	PatternSequential ReadPattern = "sequential"
+	// Read the runs of a file in a shuffled order, like a random access consumer would
+	PatternRandom ReadPattern = "random"
+)
+
+// randomSpans hands out the runs of blocks from first to end in a shuffled order, the same for the same seed and path
+// Computed on the fly like stridedSpans, the order is a keyed permutation of the run numbers instead of a shuffled slice
+type randomSpans struct {
+	first, end int64
+	run        int64
+	runs       uint64
+	// The permutation works on the smallest power of two holding all runs, numbers past the last run are skipped
+	width uint
+	keys  [3]uint64
+}
+
+// newRandomSpans shuffles the runs of up to run blocks, seed and path pick the order
+func newRandomSpans(first, end int64, run int, seed int64, path string) randomSpans {
+	s := randomSpans{first: first, end: end, run: int64(max(run, 1))}
+	if end > first {
+		s.runs = uint64((end - first + s.run - 1) / s.run)
+		s.width = uint(bits.Len64(s.runs - 1))
+	}
+
+	// Files get orders of their own, a file read twice with the same seed gets the same one
+	hash := fnv.New64a()
+	hash.Write([]byte(path))
+	state := uint64(seed) ^ hash.Sum64()
+	for i := range s.keys {
+		s.keys[i] = splitMix64(&state)
+	}
+	return s
+}
+
+func (s randomSpans) len() int {
+	return int(s.runs)
+}
+
+func (s randomSpans) at(i int) blockSpan {
+	// Permuting again until the number is a run keeps it a permutation of the runs, it takes two tries on average
+	n := s.permute(uint64(i))
+	for n >= s.runs {
+		n = s.permute(n)
+	}
+	start := s.first + int64(n)*s.run
+	return blockSpan{start: start, end: min(start+s.run, s.end)}
+}
+
+// permute maps the numbers below 2^width onto themselves, every step of a round can be undone
+func (s randomSpans) permute(n uint64) uint64 {
+	mask := uint64(1)<<s.width - 1
+	for _, key := range s.keys {
+		n = n * (key | 1) & mask
+		n ^= n >> (s.width/2 + 1)
+		n = (n + key) & mask
+	}
+	return n
+}
+
+// splitMix64 returns the next number of the sequence state is at, to turn a seed into keys
+func splitMix64(state *uint64) uint64 {
+	*state += 0x9e3779b97f4a7c15
+	z := *state
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	return z ^ z>>31
+}
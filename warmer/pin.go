@@ -0,0 +1,23 @@
+package warmer
+
+import "sync/atomic"
+
+// cpuPinner hands out the CPUs the process may run on to the workers, one each, see Options.PinCPUs
+// Shared by all groups and batches of a warmup, so workers running at the same time get distinct CPUs
+type cpuPinner struct {
+	cpus []int
+	next atomic.Int64
+	// Set once a worker had to share a CPU, the warning is only worth logging once
+	shared atomic.Bool
+}
+
+// pin locks the calling goroutine to its thread and the thread to the next CPU, returning the CPU
+// The thread exits with the goroutine, as it's never unlocked, like for setThreadIOPriority
+func (p *cpuPinner) pin(logger *Logger) (int, error) {
+	i := int(p.next.Add(1) - 1)
+	if i >= len(p.cpus) && !p.shared.Swap(true) {
+		logger.Warnf("More workers than the %d CPUs available, some of them share a CPU\n", len(p.cpus))
+	}
+	cpu := p.cpus[i%len(p.cpus)]
+	return cpu, pinThread(cpu)
+}
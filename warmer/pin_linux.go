@@ -0,0 +1,38 @@
+//go:build linux
+
+package warmer
+
+import (
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// newCPUPinner uses the CPUs of the affinity mask, e.g. the ones of a cpuset the process was started in
+func newCPUPinner() (*cpuPinner, error) {
+	var set unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &set); err != nil {
+		return nil, err
+	}
+	p := &cpuPinner{}
+	for cpu := 0; len(p.cpus) < set.Count(); cpu++ {
+		if set.IsSet(cpu) {
+			p.cpus = append(p.cpus, cpu)
+		}
+	}
+	return p, nil
+}
+
+// pinThread sets the affinity of the thread the calling goroutine runs on to a single CPU
+// https://man7.org/linux/man-pages/man2/sched_setaffinity.2.html
+func pinThread(cpu int) error {
+	runtime.LockOSThread()
+	var set unix.CPUSet
+	set.Set(cpu)
+	// Pid 0 is the calling thread
+	return unix.SchedSetaffinity(0, &set)
+}
+
+func checkCPUPinning() error {
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package warmer
+
+import "errors"
+
+var errCPUPinningUnsupported = errors.New("pinning workers to CPUs is only supported on Linux")
+
+func newCPUPinner() (*cpuPinner, error) {
+	return nil, errCPUPinningUnsupported
+}
+
+func pinThread(cpu int) error {
+	return errCPUPinningUnsupported
+}
+
+func checkCPUPinning() error {
+	return errCPUPinningUnsupported
+}
@@ -0,0 +1,214 @@
+package warmer
+
+import (
+	"errors"
+	"os"
+)
+
+// Plan describes the work a warmup would do, without reading anything
+type Plan struct {
+	FileCount        int           `json:"file_count"`
+	TotalBytes       int64         `json:"total_bytes"`
+	TotalBlocks      int64         `json:"total_blocks"`
+	AssumedRateMBs   float64       `json:"assumed_rate_mb_s"`
+	EstimatedSeconds float64       `json:"estimated_seconds"`
+	Files            []PlannedFile `json:"files"`
+	// How the blocks would be handed out, only with explain
+	Dispatch *PlannedDispatch `json:"dispatch,omitempty"`
+}
+
+// PlannedDispatch is how the files of each group would be handed to their workers
+// With a backend there are no workers, the files are handed to it one after the other
+type PlannedDispatch struct {
+	Mode    string `json:"mode"`
+	Backend string `json:"backend,omitempty"`
+	// Files warmed at the same time per group, each with workers of its own
+	Lanes            int  `json:"lanes"`
+	SmallFileWorkers int  `json:"small_file_workers"`
+	LargeFileWorkers int  `json:"large_file_workers"`
+	PerDiskPools     bool `json:"per_disk_pools,omitempty"`
+}
+
+// PlannedFile is the work planned for a single file
+type PlannedFile struct {
+	Path      string `json:"path"`
+	SizeBytes int64  `json:"size_bytes"`
+	// Less than the size when only a range of the file is warmed
+	WarmBytes int64  `json:"warm_bytes"`
+	Blocks    int64  `json:"blocks"`
+	Error     string `json:"error,omitempty"`
+	// How the blocks would be read, only with explain
+	Explain *FileExplanation `json:"explain,omitempty"`
+}
+
+// FileExplanation is how the blocks of a file would be dispatched
+// Workers take the next run off a channel shared by the lane, so none is tied to some blocks
+// Order is sequential, strided, random or physical
+// Strided spans are the region of every worker, a run of each is dispatched at a time so the workers read a region each
+type FileExplanation struct {
+	BlockSize     int64         `json:"block_size"`
+	BlocksPerRead int           `json:"blocks_per_read"`
+	Adaptive      bool          `json:"adaptive,omitempty"`
+	Workers       int           `json:"workers"`
+	Order         string        `json:"order"`
+	Spans         []PlannedSpan `json:"spans"`
+	// Spans left out, only the first explainedSpans are listed, strided ones all are
+	MoreSpans int `json:"more_spans,omitempty"`
+}
+
+// PlannedSpan is blocks first to end, end excluded, dispatched one after the other
+// Worker is only set for strided files, the one of the workers whose region the span is
+type PlannedSpan struct {
+	Worker     int   `json:"worker"`
+	FirstBlock int64 `json:"first_block"`
+	EndBlock   int64 `json:"end_block"`
+	// Runs of BlocksPerRead blocks the span is read in
+	Runs int64 `json:"runs"`
+}
+
+// Spans listed per file with explain, a huge file has millions of them
+const explainedSpans = 8
+
+// NewPlan stats the files to size the work, they are not opened
+// assumedRate in bytes per second is only used to estimate the time
+// With explain the plan tells how the blocks of every file would be dispatched
+func NewPlan(filePaths []string, opts Options, assumedRate int64, explain bool) (Plan, error) {
+	// Like Warm, so the plan shows what would be used when options are left empty
+	opts.setDefaults()
+	filePaths, infos, _ := dedupePaths(filePaths)
+	plan := Plan{
+		FileCount:      len(filePaths),
+		AssumedRateMBs: float64(assumedRate) / 1024 / 1024,
+		Files:          make([]PlannedFile, 0, len(filePaths)),
+	}
+	_, isBackend := lookupBackend(opts.Method)
+	largeWorkers := opts.LargeFilesWorkerCount
+	if opts.WorkersPerDisk > 0 {
+		largeWorkers = opts.WorkersPerDisk
+	}
+	if explain {
+		plan.Dispatch = &PlannedDispatch{
+			Mode:             string(opts.Dispatch),
+			Lanes:            max(opts.FileConcurrency, 1),
+			SmallFileWorkers: opts.SmallFilesWorkerCount,
+			LargeFileWorkers: largeWorkers,
+			PerDiskPools:     opts.WorkersPerDisk > 0,
+		}
+		if isBackend {
+			plan.Dispatch = &PlannedDispatch{Backend: string(opts.Method)}
+		}
+	}
+
+	var errs []error
+	for i, filePath := range filePaths {
+		file := PlannedFile{Path: filePath}
+		info := infos[i]
+		var err error
+		if info == nil {
+			// Stat again for the error, dedupePaths only kept the path
+			_, err = os.Stat(filePath)
+		}
+		if err == nil && !isWarmable(info.Mode()) {
+			if opts.Logger != nil {
+				opts.Logger.Warnf("Skipping %s, it's a %s and not a regular file or block device\n", filePath, fileType(info.Mode()))
+			}
+			plan.FileCount--
+			continue
+		}
+		var size int64
+		if err == nil {
+			size, err = pathSize(filePath, info)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			file.Error = err.Error()
+			plan.Files = append(plan.Files, file)
+			continue
+		}
+
+		// Same split as the warmup, blocks of small files can have another size
+		blockSize, workers := opts.BlockSizeForLargeFiles, largeWorkers
+		if size <= opts.SmallFileSizeThreshold {
+			blockSize, workers = opts.BlockSizeForSmallFiles, opts.SmallFilesWorkerCount
+		}
+		file.SizeBytes = size
+		var byteRange *ByteRange
+		if r, ok := opts.rangeOf(filePath); ok {
+			byteRange = &r
+		}
+		regions := regionSpans(byteRange, opts.tailOf(filePath), size, blockSize)
+		for _, region := range regions {
+			file.Blocks += region.end - region.start
+			file.WarmBytes += spanBytes(region.start, region.end, size, blockSize)
+		}
+		if explain && !isBackend {
+			file.Explain = explainFile(filePath, regions, blockSize, workers, opts)
+		}
+
+		plan.TotalBytes += file.WarmBytes
+		plan.TotalBlocks += file.Blocks
+		plan.Files = append(plan.Files, file)
+	}
+	if assumedRate > 0 {
+		plan.EstimatedSeconds = float64(plan.TotalBytes) / float64(assumedRate)
+	}
+	return plan, errors.Join(errs...)
+}
+
+// explainFile lists the spans of the file in the order prepareFile would dispatch them
+// Physical order needs the extents, the regions are listed in logical order then
+func explainFile(path string, regions []blockSpan, blockSize int64, workers int, opts Options) *FileExplanation {
+	blocksPerRead := opts.readBlocks(blockSize)
+	explanation := &FileExplanation{
+		BlockSize:     blockSize,
+		BlocksPerRead: blocksPerRead,
+		Adaptive:      opts.Adaptive,
+		Workers:       workers,
+		Order:         "sequential",
+		Spans:         []PlannedSpan{},
+	}
+	planned := func(worker int, span blockSpan) PlannedSpan {
+		runs := (span.end - span.start + int64(blocksPerRead) - 1) / int64(blocksPerRead)
+		return PlannedSpan{Worker: worker, FirstBlock: span.start, EndBlock: span.end, Runs: runs}
+	}
+	add := func(span blockSpan) {
+		if span.end <= span.start {
+			return
+		}
+		if len(explanation.Spans) == explainedSpans {
+			explanation.MoreSpans++
+			return
+		}
+		explanation.Spans = append(explanation.Spans, planned(0, span))
+	}
+
+	for _, region := range regions {
+		switch {
+		case opts.Stride:
+			// A worker without a region, when the file has fewer runs than workers, reads nothing of it
+			explanation.Order = "strided"
+			strided := newStridedSpans(region.start, region.end, workers, blocksPerRead)
+			for worker := 0; worker < int(strided.streams); worker++ {
+				start := min(region.start+int64(worker)*strided.region, region.end)
+				if end := min(start+strided.region, region.end); end > start {
+					explanation.Spans = append(explanation.Spans, planned(worker, blockSpan{start: start, end: end}))
+				}
+			}
+		case opts.Pattern == PatternRandom:
+			explanation.Order = "random"
+			random := newRandomSpans(region.start, region.end, blocksPerRead, opts.Seed, path)
+			// Runs are never empty, the ones not listed are only counted
+			listed := min(random.len(), explainedSpans-len(explanation.Spans))
+			for i := 0; i < listed; i++ {
+				add(random.at(i))
+			}
+			explanation.MoreSpans += random.len() - listed
+		default:
+			if opts.PhysicalOrder {
+				explanation.Order = "physical"
+			}
+			add(region)
+		}
+	}
+	return explanation
+}
@@ -0,0 +1,69 @@
+package warmer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewPlanExplainStride(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "large", 10*64*1024+1)
+	opts := testOptions()
+	opts.Stride = true
+	opts.BlocksPerRead = 2
+	opts.LargeFilesWorkerCount = 3
+
+	plan, err := NewPlan([]string{path}, opts, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	explanation := plan.Files[0].Explain
+	if explanation == nil || explanation.Order != "strided" {
+		t.Fatalf("explanation = %+v, want a strided one", explanation)
+	}
+	// 11 blocks in regions of 2 runs of 2 blocks, the last region is the rest
+	want := []PlannedSpan{
+		{Worker: 0, FirstBlock: 0, EndBlock: 4, Runs: 2},
+		{Worker: 1, FirstBlock: 4, EndBlock: 8, Runs: 2},
+		{Worker: 2, FirstBlock: 8, EndBlock: 11, Runs: 2},
+	}
+	if !reflect.DeepEqual(explanation.Spans, want) {
+		t.Fatalf("spans = %+v, want %+v", explanation.Spans, want)
+	}
+}
+
+func TestNewPlanExplainStrideListsEveryWorker(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "large", 2*explainedSpans*10*64*1024)
+	opts := testOptions()
+	opts.Stride = true
+	opts.LargeFilesWorkerCount = 2 * explainedSpans
+
+	plan, err := NewPlan([]string{path}, opts, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	explanation := plan.Files[0].Explain
+	if len(explanation.Spans) != 2*explainedSpans || explanation.MoreSpans != 0 {
+		t.Fatalf("%d spans listed and %d more, want all %d workers listed", len(explanation.Spans), explanation.MoreSpans, 2*explainedSpans)
+	}
+	for i, span := range explanation.Spans {
+		if span.Worker != i {
+			t.Fatalf("span %d is of worker %d", i, span.Worker)
+		}
+	}
+}
+
+func TestNewPlanDefaults(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "small", 10000)
+	opts := testOptions()
+
+	plan, err := NewPlan([]string{path}, opts, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Dispatch.Mode != string(DispatchSequential) || plan.Dispatch.Lanes != 1 {
+		t.Fatalf("dispatch = %+v, want the sequential default with a single lane", plan.Dispatch)
+	}
+	if explanation := plan.Files[0].Explain; explanation.BlocksPerRead != 1 {
+		t.Fatalf("blocks per read = %d, want the default of 1", explanation.BlocksPerRead)
+	}
+}
@@ -0,0 +1,118 @@
+package warmer
+
+import (
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// Pool keeps the workers of a warmup once it's done, so the next warmup given the pool takes them over, see Options.Pool
+// For a process running one warmup after the other, like a daemon, workers keep their buffers and io_uring rings
+// Idle workers hold on to their buffers, until they are taken over or the pool is closed
+type Pool struct {
+	mu     sync.Mutex
+	idle   []*poolWorker
+	closed bool
+}
+
+// poolWorker runs the workers of the warmups it's handed, one after the other
+// Locked to its thread for good, so the I/O priority set for one warmup never reaches other goroutines
+type poolWorker struct {
+	state *workerState
+	work  chan func(*workerState)
+}
+
+func NewPool() *Pool {
+	return &Pool{}
+}
+
+// Close stops the idle workers, the ones still busy with a warmup stop once it's done
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, w := range p.idle {
+		close(w.work)
+	}
+	p.idle = nil
+}
+
+// run runs a worker on an idle goroutine whose thread has the I/O priority, or on a new one
+func (p *Pool) run(ioPriority IOPriority, worker func(*workerState)) {
+	p.mu.Lock()
+	for i, w := range p.idle {
+		if w.state.ioPriority == ioPriority {
+			p.idle = slices.Delete(p.idle, i, i+1)
+			p.mu.Unlock()
+			w.work <- worker
+			return
+		}
+	}
+	p.mu.Unlock()
+
+	w := &poolWorker{state: &workerState{}, work: make(chan func(*workerState), 1)}
+	w.work <- worker
+	go p.loop(w)
+}
+
+func (p *Pool) loop(w *poolWorker) {
+	runtime.LockOSThread()
+	defer w.state.close()
+	for worker := range w.work {
+		worker(w.state)
+
+		// A thread pinned to a CPU exits with the goroutine, the next warmup hands out the CPUs anew
+		p.mu.Lock()
+		if w.state.pinned || p.closed {
+			p.mu.Unlock()
+			return
+		}
+		p.idle = append(p.idle, w)
+		p.mu.Unlock()
+	}
+}
+
+// workerState is what a worker reads with, kept when the worker is part of a Pool
+type workerState struct {
+	buffers   [][]byte
+	blockSize int64
+	batch     *ioUringBatch
+	// What the thread of the worker was set up with
+	ioPriority IOPriority
+	pinned     bool
+}
+
+// readBuffers returns a buffer per block of a run, allocated again when the block size changed
+func (s *workerState) readBuffers(blockSize int64, blocksPerRead int) [][]byte {
+	if s.blockSize != blockSize {
+		s.buffers, s.blockSize = nil, blockSize
+	}
+	for len(s.buffers) < blocksPerRead {
+		s.buffers = append(s.buffers, alignedBuffer(blockSize))
+	}
+	return s.buffers[:blocksPerRead]
+}
+
+// ioUringBatch returns the batch of the worker, a new one when there's none yet for the block size
+func (s *workerState) ioUringBatch(blockSize int64, retries int, logger *Logger) (*ioUringBatch, error) {
+	if s.batch != nil && s.batch.blockSize == blockSize {
+		s.batch.retries, s.batch.logger = retries, logger
+		return s.batch, nil
+	}
+	if s.batch != nil {
+		s.batch.close()
+		s.batch = nil
+	}
+	batch, err := newIOUringBatch(blockSize, retries, logger)
+	if err != nil {
+		return nil, err
+	}
+	s.batch = batch
+	return batch, nil
+}
+
+func (s *workerState) close() {
+	if s.batch != nil {
+		s.batch.close()
+	}
+}
@@ -0,0 +1,86 @@
+package warmer
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPoolKeepsWorkersAcrossWarmups(t *testing.T) {
+	for _, method := range []FileIOMethod{PosixSync, IOUring} {
+		t.Run(string(method), func(t *testing.T) {
+			if method == IOUring && probeIOUring() != nil {
+				t.Skip("io_uring is not available")
+			}
+			dir := t.TempDir()
+			// Only large files, the small ones would be warmed first by workers the large ones may take over
+			paths := []string{
+				writeTestFile(t, dir, "a", 1<<20+123),
+				writeTestFile(t, dir, "b", 300000),
+			}
+
+			pool := NewPool()
+			defer pool.Close()
+			opts := testOptions()
+			opts.Method = method
+			opts.Pool = pool
+
+			workers := opts.LargeFilesWorkerCount
+			for run := 0; run < 3; run++ {
+				result, err := Warm(context.Background(), paths, opts)
+				if err != nil {
+					t.Fatalf("run %d: %v", run, err)
+				}
+				if want := int64(1<<20 + 123 + 300000); result.TotalBytes != want {
+					t.Fatalf("run %d read %d bytes, want %d", run, result.TotalBytes, want)
+				}
+
+				if idle := waitIdle(pool, workers); idle != workers {
+					t.Fatalf("run %d left %d idle workers, want %d", run, idle, workers)
+				}
+			}
+		})
+	}
+}
+
+// waitIdle returns the number of idle workers once there are want of them, or after a second
+// Workers hand themselves back once done, which may be after Warm returned
+func waitIdle(pool *Pool, want int) int {
+	deadline := time.Now().Add(time.Second)
+	for {
+		pool.mu.Lock()
+		idle := len(pool.idle)
+		pool.mu.Unlock()
+		if idle == want || time.Now().After(deadline) {
+			return idle
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPoolMatchesIOPriority(t *testing.T) {
+	pool := NewPool()
+	defer pool.Close()
+	idle := &poolWorker{state: &workerState{ioPriority: IOPriority{Class: IOPriorityIdle}}, work: make(chan func(*workerState), 1)}
+	pool.idle = []*poolWorker{idle}
+
+	// A warmup leaving the priority unchanged can't run on a thread set to idle
+	done := make(chan struct{})
+	pool.run(IOPriority{}, func(*workerState) { close(done) })
+	<-done
+	if len(idle.work) != 0 {
+		t.Fatal("worker with the idle I/O priority was handed a warmup leaving it unchanged")
+	}
+
+	pool.run(IOPriority{Class: IOPriorityIdle}, func(*workerState) {})
+	if len(idle.work) != 1 {
+		t.Fatal("warmup with the idle I/O priority didn't get the worker that has it")
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	for _, w := range pool.idle {
+		if w == idle {
+			t.Fatal("worker handed a warmup is still idle")
+		}
+	}
+}
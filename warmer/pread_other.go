@@ -0,0 +1,26 @@
+//go:build !unix
+
+package warmer
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// fileReader reads through the file without pread(2), its reads at the end of file come back short like pread ones
+type fileReader struct {
+	file *os.File
+}
+
+func newFileReader(file *os.File) fileReader {
+	return fileReader{file: file}
+}
+
+func (r fileReader) ReadAt(buffer []byte, offset int64) (int, error) {
+	n, err := r.file.ReadAt(buffer, offset)
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return n, err
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package warmer
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// fileReader reads with pread(2), which unlike io.ReaderAt returns short reads without an error
+type fileReader int
+
+func newFileReader(file *os.File) fileReader {
+	return fileReader(file.Fd())
+}
+
+func (fd fileReader) ReadAt(buffer []byte, offset int64) (int, error) {
+	return unix.Pread(int(fd), buffer, offset)
+}
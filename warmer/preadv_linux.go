@@ -0,0 +1,10 @@
+//go:build linux
+
+package warmer
+
+import "golang.org/x/sys/unix"
+
+// https://man7.org/linux/man-pages/man2/preadv.2.html
+func preadv(r fileReader, buffers [][]byte, offset int64) (int, error) {
+	return unix.Preadv(int(r), buffers, offset)
+}
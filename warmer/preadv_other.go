@@ -0,0 +1,18 @@
+//go:build !linux
+
+package warmer
+
+// No preadv here, read the buffers one by one instead
+func preadv(r fileReader, buffers [][]byte, offset int64) (int, error) {
+	total := 0
+	for _, buffer := range buffers {
+		n, err := r.ReadAt(buffer, offset+int64(total))
+		if n > 0 {
+			total += n
+		}
+		if err != nil || n < len(buffer) {
+			return total, err
+		}
+	}
+	return total, nil
+}
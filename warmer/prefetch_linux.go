@@ -0,0 +1,92 @@
+//go:build linux
+
+package warmer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// How often residency is checked while waiting for the prefetch
+const residencyPollInterval = 100 * time.Millisecond
+
+// Longest wait for a file to become resident when its context has no deadline
+// Pages evicted as fast as they come in, e.g. under memory pressure, would keep the wait going forever
+const maxResidentWait = 10 * time.Minute
+
+// adviseWillNeed starts an asynchronous prefetch of the file, window by window like madviseWillNeed
+// With waitResident it then waits for every window to be in page cache, until the deadline of ctx or maxResidentWait
+// https://man7.org/linux/man-pages/man2/posix_fadvise.2.html
+func adviseWillNeed(ctx context.Context, file *os.File, size int64, waitResident bool) error {
+	fd := int(file.Fd())
+	for offset := int64(0); offset < size; offset += mmapWindowSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := unix.Fadvise(fd, offset, min(mmapWindowSize, size-offset), unix.FADV_WILLNEED); err != nil {
+			return err
+		}
+	}
+	if !waitResident {
+		return nil
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, maxResidentWait, fmt.Errorf("not resident in page cache after %v", maxResidentWait))
+		defer cancel()
+	}
+	for offset := int64(0); offset < size; offset += mmapWindowSize {
+		if err := waitWindowResident(ctx, fd, offset, min(mmapWindowSize, size-offset)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitWindowResident polls until the pages of a window of the file are all in page cache
+func waitWindowResident(ctx context.Context, fd int, offset, length int64) error {
+	// mincore needs a mapping of the file to report which pages are in page cache
+	data, err := unix.Mmap(fd, offset, int(length), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	defer unix.Munmap(data)
+
+	pageSize := int64(os.Getpagesize())
+	residency := make([]byte, (length+pageSize-1)/pageSize)
+	for {
+		if err := mincore(data, residency); err != nil {
+			return err
+		}
+		if allResident(residency) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-time.After(residencyPollInterval):
+		}
+	}
+}
+
+// readahead populates page cache for a range without copying the data to userspace
+// https://man7.org/linux/man-pages/man2/readahead.2.html
+// golang.org/x/sys/unix has no wrapper, the raw call assumes 64-bit registers for the offset
+func readahead(fd int, offset int64, length int64) error {
+	if unsafe.Sizeof(uintptr(0)) < 8 {
+		return errors.New("readahead is only supported on 64-bit platforms")
+	}
+	_, _, errno := unix.Syscall(unix.SYS_READAHEAD, uintptr(fd), uintptr(offset), uintptr(length))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package warmer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestAdviseWillNeedWaitsForResidency(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "file", 3*1024*1024+1)
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	// Written pages are only dropped once they are clean
+	if err := file.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := unix.Fadvise(int(file.Fd()), 0, 0, unix.FADV_DONTNEED); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := adviseWillNeed(ctx, file, 3*1024*1024+1, true); err != nil {
+		t.Fatalf("adviseWillNeed: %v", err)
+	}
+	residency, err := pageResidency(file, 3*1024*1024+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !allResident(residency) {
+		t.Fatal("pages of the file still not resident after waiting")
+	}
+}
+
+func TestAdviseWillNeedWaitEndsWithContext(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "file", 1024*1024)
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	// The claimed size reaches past the end of file, those pages never become resident
+	ctx, cancel := context.WithTimeoutCause(context.Background(), 300*time.Millisecond, errGivenUp)
+	defer cancel()
+	start := time.Now()
+	err = adviseWillNeed(ctx, file, 4*1024*1024, true)
+	if !errors.Is(err, errGivenUp) {
+		t.Fatalf("adviseWillNeed = %v, want the cause of the deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("adviseWillNeed returned %v after the deadline", elapsed)
+	}
+}
+
+var errGivenUp = errors.New("given up")
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package warmer
+
+import (
+	"context"
+	"errors"
+	"os"
+)
+
+func adviseWillNeed(ctx context.Context, file *os.File, size int64, waitResident bool) error {
+	return errors.New("willneed is only supported on Linux")
+}
+
+func readahead(fd int, offset int64, length int64) error {
+	return errors.New("readahead is only supported on Linux")
+}
@@ -0,0 +1,345 @@
+package warmer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Counters are updated by the workers as blocks get read
+// Safe to read while the warmup is running, e.g. to render progress
+type Counters struct {
+	BytesTotal  atomic.Int64
+	BytesRead   atomic.Int64
+	BlocksTotal atomic.Int64
+	BlocksDone  atomic.Int64
+	// Blocks left out because they were already in page cache
+	BlocksSkipped atomic.Int64
+	// Blocks left out because they lie entirely in holes of sparse files
+	BlocksHoles atomic.Int64
+	// Blocks that still failed after all retries
+	BlocksFailed atomic.Int64
+	// Files done, failed ones included
+	FilesDone  atomic.Int64
+	FilesTotal atomic.Int64
+}
+
+// errFileTimeout is the cause of a file context whose deadline expired
+var errFileTimeout = errors.New("file timed out")
+
+// errFileRemoved is the cause of a file context given up on as the file got deleted while it was read
+var errFileRemoved = errors.New("removed during warm")
+
+// errPartialRead is the error of a file read short of its bytes with Options.Strict, e.g. as it got truncated
+var errPartialRead = errors.New("partially warmed")
+
+// errTooManyFailedBlocks is the cause of a file context given up on after MaxFileErrors failed blocks in a row
+var errTooManyFailedBlocks = errors.New("too many failed blocks in a row")
+
+// fileProgress tracks the warmup of a single file
+// Blocks of a file are read by many workers, the last one to finish records the end time
+type fileProgress struct {
+	file *os.File
+	path string
+	size int64
+	// Totals of the whole warmup, updated along with the file
+	counters *Counters
+	// Set when the file is verified against expectedSum
+	hasher      *fileHasher
+	expectedSum []byte
+	// Only this part of the file is warmed when set
+	byteRange *ByteRange
+	// Bytes at the end of file warmed with Options.Tail, besides the head in byteRange if any
+	tail int64
+	// Opened without O_DIRECT as its filesystem doesn't support it, it's read through page cache
+	buffered bool
+	// Every run read is dropped from page cache again, see Options.EvictAfter
+	evictAfter bool
+	// Bytes read from the start of every block with Options.TouchOnly, 0 reads whole blocks
+	touch int64
+	// Device the file lives on, for limiting the files warmed per device
+	device    uint64
+	hasDevice bool
+	// Lets the next file of the device start once this one is done, set by the queue
+	release func()
+	// Called with the first error of the file, stops the warmup with Strict
+	onFail func(error)
+	// Told when the file starts and finishes, with Options.OnProgress
+	reporter *progressReporter
+	// Reads of the file stop once it's done, set by begin
+	ctx         context.Context
+	cancel      context.CancelFunc
+	cancelCause context.CancelCauseFunc
+	// Failed blocks in a row after which the rest of the file is given up on, 0 means never
+	maxErrors int
+
+	startTime time.Time
+	warmBytes int64        // Bytes of the blocks to read, set by start
+	pending   atomic.Int64 // Blocks dispatched but not read yet
+	readBytes atomic.Int64
+
+	mu      sync.Mutex
+	endTime time.Time
+	err     error
+	closed  bool
+	// Offsets of the blocks that couldn't be read
+	failedBlocks []int64
+	failedInRow  int
+	verify       string
+	// Deleted while it was read, the rest of it is left alone and it doesn't count as failed
+	removed bool
+	// Bytes to warm that weren't read though no read failed, set by finish
+	missingBytes int64
+	// Read latencies merged from the workers, with Options.Histogram
+	latencies *latencyHistogram
+}
+
+// addLatencies merges read latencies a worker measured
+func (p *fileProgress) addLatencies(histogram *latencyHistogram) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.latencies == nil {
+		p.latencies = &latencyHistogram{}
+	}
+	p.latencies.merge(histogram)
+}
+
+// begin derives the context of the file from the warmup, with a deadline when timeout is set
+// The deadline covers everything done for the file, from checking residency to the last read
+func (p *fileProgress) begin(ctx context.Context, timeout time.Duration) {
+	p.ctx, p.cancelCause = context.WithCancelCause(ctx)
+	p.cancel = func() { p.cancelCause(nil) }
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		p.ctx, cancelTimeout = context.WithTimeoutCause(p.ctx, timeout, fmt.Errorf("%w after %v", errFileTimeout, timeout))
+		p.cancel = func() {
+			cancelTimeout()
+			p.cancelCause(nil)
+		}
+	}
+}
+
+// skip accounts blocks that won't be read because the file context is done
+// The file is marked timed out if its deadline is the reason
+func (p *fileProgress) skip(blocks int) {
+	if err := context.Cause(p.ctx); errors.Is(err, errFileTimeout) {
+		p.fail(err)
+	}
+	p.complete(blocks, 0)
+}
+
+// start must be called before the first block is dispatched, bytes is what the blocks hold
+func (p *fileProgress) start(blocks int64, bytes int64) {
+	p.startTime = time.Now()
+	p.warmBytes = bytes
+	p.pending.Store(blocks)
+	if p.reporter != nil {
+		p.reporter.started(p)
+	}
+	if blocks == 0 {
+		p.finish()
+	}
+}
+
+// complete records that blocks were read, n bytes in total
+func (p *fileProgress) complete(blocks int, n int64) {
+	if n > 0 {
+		p.readBytes.Add(n)
+		p.counters.BytesRead.Add(n)
+	}
+	p.counters.BlocksDone.Add(int64(blocks))
+	if p.pending.Add(int64(-blocks)) == 0 {
+		p.finish()
+	}
+}
+
+// fail keeps the first error of the file, later ones are usually the same
+func (p *fileProgress) fail(err error) {
+	p.mu.Lock()
+	first := p.err == nil
+	if first {
+		p.err = err
+	}
+	p.mu.Unlock()
+	if first && p.onFail != nil {
+		p.onFail(err)
+	}
+}
+
+// abort fails a file before any of its blocks got dispatched, it's done right away
+func (p *fileProgress) abort(err error) {
+	p.fail(err)
+	p.counters.FilesDone.Add(1)
+	if p.release != nil {
+		p.release()
+	}
+	if p.reporter != nil {
+		p.reporter.finished(p)
+	}
+}
+
+// failBlock records a block that couldn't be read even after retrying
+// A file deleted in the meantime is given up on instead, false tells that it wasn't a read error
+func (p *fileProgress) failBlock(offset int64, err error) bool {
+	if wasRemoved(p.path, err) {
+		p.mu.Lock()
+		p.removed = true
+		p.mu.Unlock()
+		if p.hasher != nil {
+			p.hasher.fail()
+		}
+		p.cancelCause(fmt.Errorf("%w: %w", errFileRemoved, err))
+		return false
+	}
+
+	p.counters.BlocksFailed.Add(1)
+	p.fail(err)
+	if p.hasher != nil {
+		p.hasher.fail()
+	}
+
+	p.mu.Lock()
+	p.failedBlocks = append(p.failedBlocks, offset)
+	p.failedInRow++
+	giveUp := p.maxErrors > 0 && p.failedInRow == p.maxErrors
+	p.mu.Unlock()
+
+	// The backing store is likely gone, e.g. ESTALE from a dead mount, the remaining blocks would fail alike
+	if giveUp {
+		p.cancelCause(fmt.Errorf("%w (%d): %w", errTooManyFailedBlocks, p.maxErrors, err))
+	}
+	return true
+}
+
+// wasRemoved tells if a read failed as the file got deleted, e.g. with ESTALE on NFS or ENOENT on FUSE
+// Other errors count too once the path is gone, spools remove files at any time
+// Local filesystems keep reading a deleted file that is still open, those reads don't fail
+func wasRemoved(path string, err error) bool {
+	if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ESTALE) {
+		return true
+	}
+	_, statErr := os.Lstat(path)
+	return errors.Is(statErr, os.ErrNotExist)
+}
+
+// readBlock records a block read fine, a failing file is given another chance
+func (p *fileProgress) readBlock() {
+	if p.maxErrors == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failedInRow = 0
+}
+
+// finish also closes the file, no reads are left that could use its descriptor
+// Every byte to warm has to be read by now, a shortfall fails the file only with Options.Strict
+func (p *fileProgress) finish() {
+	partialErr := p.checkBytesRead()
+	if partialErr != nil && p.onFail != nil {
+		p.fail(partialErr)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.endTime = time.Now()
+	p.counters.FilesDone.Add(1)
+	if p.cancel != nil {
+		p.cancel()
+	}
+	if p.hasher != nil {
+		p.verify = p.hasher.verify(p.size, p.expectedSum)
+	}
+	p.closeLocked()
+	if p.reporter != nil {
+		p.reporter.finished(p)
+	}
+}
+
+// checkBytesRead records the bytes to warm that weren't read, returning the error the file fails with under Strict
+// Files failed, removed or cancelled are short for a reason already known, so only the others are checked
+// That leaves reads stopping early without an error, e.g. at an end of file come early as the file got truncated
+func (p *fileProgress) checkBytesRead() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	missing := p.warmBytes - p.readBytes.Load()
+	if missing <= 0 || p.err != nil || p.removed || (p.ctx != nil && p.ctx.Err() != nil) {
+		return nil
+	}
+	p.missingBytes = missing
+	return fmt.Errorf("%w, %d of %d bytes weren't read", errPartialRead, missing, p.warmBytes)
+}
+
+// close releases the file if it wasn't closed on finish, e.g. when the warmup got cancelled
+// Must only be called once no worker reads from it anymore
+func (p *fileProgress) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closeLocked()
+}
+
+func (p *fileProgress) closeLocked() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	if p.release != nil {
+		p.release()
+	}
+	if p.file != nil && !p.closed {
+		p.file.Close()
+		p.closed = true
+	}
+}
+
+// progress is what Options.OnProgress gets to see of the file
+func (p *fileProgress) progress() FileProgress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return FileProgress{Path: p.path, BytesDone: p.readBytes.Load(), BytesTotal: p.warmBytes, Err: p.err}
+}
+
+// failure returns the first error of the file, nil if it was warmed fine
+func (p *fileProgress) failure() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+func (p *fileProgress) stat() FileStat {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stat := FileStat{Path: p.path, SizeBytes: p.size}
+	if !p.startTime.IsZero() {
+		// Not finished when the warmup got cancelled midway
+		endTime := p.endTime
+		if endTime.IsZero() {
+			endTime = time.Now()
+		}
+		duration := endTime.Sub(p.startTime)
+		stat.DurationSeconds = duration.Seconds()
+		if duration > 0 {
+			stat.ThroughputMBs = float64(p.readBytes.Load()) / 1024 / 1024 / duration.Seconds()
+		}
+	}
+	if p.err != nil {
+		stat.Error = p.err.Error()
+		stat.TimedOut = errors.Is(p.err, errFileTimeout)
+	}
+	stat.Removed = p.removed
+	stat.MissingBytes = p.missingBytes
+	stat.Verify = p.verify
+	if p.latencies != nil {
+		latency := p.latencies.stats()
+		stat.Latency = &latency
+	}
+	stat.FailedBlocks = slices.Clone(p.failedBlocks)
+	slices.Sort(stat.FailedBlocks)
+	return stat
+}
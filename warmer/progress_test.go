@@ -0,0 +1,75 @@
+package warmer
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFileRemovedDuringWarm(t *testing.T) {
+	const blockSize = 4096
+	tests := []struct {
+		name    string
+		remove  bool
+		readErr error
+		removed bool
+	}{
+		{"read fails once the file is deleted", true, syscall.EIO, true},
+		{"stale handle", false, syscall.ESTALE, true},
+		{"read fails on a file still there", false, syscall.EIO, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeTestFile(t, t.TempDir(), "spool", 10*blockSize)
+			file, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			opts := testOptions()
+			opts.BlocksPerRead = 1
+			counters := &Counters{}
+			group := newFileGroup(opts, blockSize, 1, nil, nil, counters, opts.Logger)
+			progress := &fileProgress{file: file, path: path, size: 10 * blockSize, counters: counters}
+			cursor, err := prepareFile(context.Background(), progress, group)
+			if err != nil {
+				t.Fatalf("prepareFile: %v", err)
+			}
+			blockChan := make(chan fileReadRequest, 1)
+			if _, err := cursor.send(context.Background(), blockChan, blockSize, 1, opts.Logger); err != nil {
+				t.Fatalf("send: %v", err)
+			}
+
+			// The dispatched block fails to read, like it would on a spool after the file got deleted
+			read := <-blockChan
+			if test.remove {
+				if err := os.Remove(path); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if failed := progress.failBlock(read.offset, test.readErr); failed == test.removed {
+				t.Fatalf("failBlock = %v, want %v", failed, !test.removed)
+			}
+			progress.complete(read.blocks, 0)
+
+			done, err := cursor.send(context.Background(), blockChan, blockSize, 1, opts.Logger)
+			if test.removed && (!done || err != nil || len(blockChan) != 0) {
+				t.Fatalf("send = %v, %v with %d blocks dispatched, want the rest of the file dropped without an error", done, err, len(blockChan))
+			}
+			if !test.removed && (done || len(blockChan) != 1) {
+				t.Fatalf("send = %v, %v, want the next block dispatched after a read error", done, err)
+			}
+
+			result := newResult([]FileStat{progress.stat()}, 0, time.Second)
+			if test.removed && (result.RemovedFiles != 1 || result.FailedFiles != 0 || result.PartialFiles != 0) {
+				t.Fatalf("removed file counted as %d removed, %d failed and %d partial, want only removed", result.RemovedFiles, result.FailedFiles, result.PartialFiles)
+			}
+			if !test.removed && (result.RemovedFiles != 0 || result.FailedFiles != 1) {
+				t.Fatalf("failed file counted as %d removed and %d failed, want only failed", result.RemovedFiles, result.FailedFiles)
+			}
+		})
+	}
+}
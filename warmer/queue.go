@@ -0,0 +1,83 @@
+package warmer
+
+import (
+	"context"
+	"sync"
+)
+
+// fileQueue hands out the files of a group to the lanes in order
+// With a per device limit, a file is only handed out while fewer files of its device are being warmed
+// Files on other devices are picked up meanwhile, so a busy disk doesn't hold back the others
+type fileQueue struct {
+	mu      sync.Mutex
+	files   []*fileProgress
+	perDisk int
+	active  map[uint64]int
+	// Closed and replaced whenever a file is released, wakes the lanes waiting for one
+	released chan struct{}
+}
+
+// newFileQueue queues the files, perDisk of 0 means no limit
+func newFileQueue(files []*fileProgress, perDisk int) *fileQueue {
+	return &fileQueue{
+		files:    files,
+		perDisk:  perDisk,
+		active:   make(map[uint64]int),
+		released: make(chan struct{}),
+	}
+}
+
+// next returns the next file that may be warmed, waiting for a file of a busy device to finish if needed
+// nil is returned once the queue is empty or ctx is done
+func (q *fileQueue) next(ctx context.Context) *fileProgress {
+	for ctx.Err() == nil {
+		q.mu.Lock()
+		if len(q.files) == 0 {
+			q.mu.Unlock()
+			return nil
+		}
+		if progress := q.takeLocked(); progress != nil {
+			q.mu.Unlock()
+			return progress
+		}
+		released := q.released
+		q.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+		}
+	}
+	return nil
+}
+
+// tryNext returns the next file that may be warmed right now, or nil without waiting
+func (q *fileQueue) tryNext() *fileProgress {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.takeLocked()
+}
+
+// takeLocked removes the first file whose device isn't busy from the queue
+func (q *fileQueue) takeLocked() *fileProgress {
+	for i, progress := range q.files {
+		if q.perDisk > 0 && progress.hasDevice && q.active[progress.device] >= q.perDisk {
+			continue
+		}
+		q.files = append(q.files[:i], q.files[i+1:]...)
+		if q.perDisk > 0 && progress.hasDevice {
+			q.active[progress.device]++
+			progress.release = sync.OnceFunc(func() { q.release(progress.device) })
+		}
+		return progress
+	}
+	return nil
+}
+
+func (q *fileQueue) release(device uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.active[device]--
+	close(q.released)
+	q.released = make(chan struct{})
+}
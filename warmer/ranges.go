@@ -0,0 +1,74 @@
+package warmer
+
+import "path/filepath"
+
+// ByteRange restricts the warmup of a file to Length bytes starting at Offset
+// A zero Length means up to the end of the file
+type ByteRange struct {
+	Offset int64
+	Length int64
+}
+
+// rangeOf returns the part of the file at path to warm, false means all of it
+// A range given for the file wins over Head, see tailOf for Tail
+func (opts Options) rangeOf(path string) (ByteRange, bool) {
+	if byteRange, ok := opts.Ranges[filepath.Clean(path)]; ok {
+		return byteRange, true
+	}
+	if opts.Head > 0 {
+		return ByteRange{Offset: 0, Length: opts.Head}, true
+	}
+	return ByteRange{}, false
+}
+
+// tailOf returns the bytes at the end of the file at path to warm, 0 means none or all of the file
+// Like Head, Tail only applies to files without a range given for them
+func (opts Options) tailOf(path string) int64 {
+	if _, ok := opts.Ranges[filepath.Clean(path)]; ok {
+		return 0
+	}
+	return opts.Tail
+}
+
+// regionSpans returns the spans of blocks of a file of size to warm, in order
+// The tail starts at size-tail rounded down to a block, with a head in byteRange too the blocks between them are left out
+func regionSpans(byteRange *ByteRange, tail int64, size, blockSize int64) []blockSpan {
+	first, end := int64(0), (size+blockSize-1)/blockSize
+	if byteRange != nil {
+		first, end = byteRange.blocks(size, blockSize)
+	}
+	if tail == 0 {
+		return []blockSpan{{start: first, end: end}}
+	}
+	tailSpan := blockSpan{start: max(size-tail, 0) / blockSize, end: (size + blockSize - 1) / blockSize}
+	switch {
+	case byteRange == nil:
+		return []blockSpan{tailSpan}
+	case tailSpan.start <= end:
+		// Head and tail overlap or touch, e.g. for files shorter than both
+		return []blockSpan{{start: first, end: tailSpan.end}}
+	}
+	return []blockSpan{{start: first, end: end}, tailSpan}
+}
+
+// blocks returns the first block and the block after the last one covering the range
+// O_DIRECT reads must stay aligned, so the start is rounded down and the end up to block boundaries
+func (r ByteRange) blocks(size, blockSize int64) (int64, int64) {
+	start, end := min(r.Offset, size), size
+	if r.Length > 0 {
+		end = min(r.Offset+r.Length, size)
+	}
+	first := start / blockSize
+	return first, max((end+blockSize-1)/blockSize, first)
+}
+
+// aligned reports if the range already starts and ends at block boundaries of the file
+func (r ByteRange) aligned(size, blockSize int64) bool {
+	first, end := r.blocks(size, blockSize)
+	return first*blockSize == r.Offset && (r.Length == 0 || min(end*blockSize, size) == min(r.Offset+r.Length, size))
+}
+
+// spanBytes is the number of bytes of the file the blocks from first to end cover
+func spanBytes(first, end, size, blockSize int64) int64 {
+	return max(min(end*blockSize, size)-first*blockSize, 0)
+}
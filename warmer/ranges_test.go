@@ -0,0 +1,90 @@
+package warmer
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestRegionSpans(t *testing.T) {
+	const blockSize = 4096
+	tests := []struct {
+		name      string
+		byteRange *ByteRange
+		tail      int64
+		size      int64
+		want      []blockSpan
+	}{
+		{"whole file", nil, 0, 10000, []blockSpan{{0, 3}}},
+		{"whole file of full blocks", nil, 0, 3 * blockSize, []blockSpan{{0, 3}}},
+		{"zero length file", nil, 0, 0, []blockSpan{{0, 0}}},
+		{"zero length file with head and tail", &ByteRange{Length: blockSize}, blockSize, 0, []blockSpan{{0, 0}}},
+		{"head", &ByteRange{Length: 5000}, 0, 100000, []blockSpan{{0, 2}}},
+		{"head longer than the file", &ByteRange{Length: 1 << 20}, 0, 10000, []blockSpan{{0, 3}}},
+		{"unaligned range", &ByteRange{Offset: 5000, Length: 4000}, 0, 100000, []blockSpan{{1, 3}}},
+		{"range up to the end of file", &ByteRange{Offset: 8192}, 0, 10000, []blockSpan{{2, 3}}},
+		{"tail", nil, 5000, 100000, []blockSpan{{23, 25}}},
+		{"tail longer than the file", nil, 1 << 20, 10000, []blockSpan{{0, 3}}},
+		{"head and tail apart", &ByteRange{Length: blockSize}, blockSize, 100000, []blockSpan{{0, 1}, {23, 25}}},
+		{"head and tail touching", &ByteRange{Length: 2 * blockSize}, blockSize, 3 * blockSize, []blockSpan{{0, 3}}},
+		{"head and tail overlapping", &ByteRange{Length: 60000}, 60000, 100000, []blockSpan{{0, 25}}},
+		{"file smaller than head and tail", &ByteRange{Length: 2 * blockSize}, 2 * blockSize, 10000, []blockSpan{{0, 3}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := regionSpans(test.byteRange, test.tail, test.size, blockSize)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("regionSpans = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPrepareFileBlockCounts(t *testing.T) {
+	const blockSize = 4096
+	dir := t.TempDir()
+	small := writeTestFile(t, dir, "small", 100)
+	large := writeTestFile(t, dir, "large", 1<<20+1)
+	empty := writeTestFile(t, dir, "empty", 0)
+	tests := []struct {
+		name      string
+		path      string
+		byteRange *ByteRange
+		tail      int64
+		blocks    int64
+		bytes     int64
+	}{
+		// Each file gets the blocks of its own size, not those of the largest file
+		{"small file", small, nil, 0, 1, 100},
+		{"large file", large, nil, 0, 257, 1<<20 + 1},
+		{"empty file", empty, nil, 0, 0, 0},
+		{"small file with head and tail", small, &ByteRange{Length: blockSize}, blockSize, 1, 100},
+		{"large file with head and tail", large, &ByteRange{Length: blockSize}, blockSize, 3, 2*blockSize + 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file, err := os.Open(test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			info, err := file.Stat()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			opts := testOptions()
+			counters := &Counters{}
+			group := newFileGroup(opts, blockSize, 1, nil, nil, counters, opts.Logger)
+			progress := &fileProgress{file: file, path: test.path, size: info.Size(), counters: counters, byteRange: test.byteRange, tail: test.tail}
+			cursor, err := prepareFile(context.Background(), progress, group)
+			if err != nil {
+				t.Fatalf("prepareFile: %v", err)
+			}
+			if cursor.blocks != test.blocks || progress.warmBytes != test.bytes {
+				t.Fatalf("prepareFile left %d blocks of %d bytes, want %d blocks of %d bytes", cursor.blocks, progress.warmBytes, test.blocks, test.bytes)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package warmer
+
+import (
+	"sync"
+	"time"
+)
+
+// How often Options.OnProgress is called for the files being warmed
+const progressReportInterval = time.Second
+
+// FileProgress is the progress of a single file handed to Options.OnProgress
+type FileProgress struct {
+	Path string
+	// Bytes read so far, out of the bytes to warm in total
+	// Holes and blocks already cached that are skipped aren't part of the total
+	BytesDone  int64
+	BytesTotal int64
+	// Set on the last call for the file, Err is why it failed
+	Done bool
+	Err  error
+}
+
+// progressReporter calls Options.OnProgress from a single goroutine, so the callback needs no locking
+// Workers only note which files started and finished, they never wait for the callback
+type progressReporter struct {
+	onProgress func(FileProgress)
+
+	mu     sync.Mutex
+	active map[*fileProgress]struct{}
+	done   []*fileProgress
+	wake   chan struct{}
+
+	stopped chan struct{}
+	exited  chan struct{}
+}
+
+// newProgressReporter starts calling onProgress, until stop
+func newProgressReporter(onProgress func(FileProgress)) *progressReporter {
+	r := &progressReporter{
+		onProgress: onProgress,
+		active:     make(map[*fileProgress]struct{}),
+		wake:       make(chan struct{}, 1),
+		stopped:    make(chan struct{}),
+		exited:     make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+func (r *progressReporter) started(p *fileProgress) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.active[p] = struct{}{}
+}
+
+// finished queues the last call for the file, made right away rather than on the next tick
+func (r *progressReporter) finished(p *fileProgress) {
+	r.mu.Lock()
+	delete(r.active, p)
+	r.done = append(r.done, p)
+	r.mu.Unlock()
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stop returns once the files finished so far got their last call, no calls are made after
+// Files still being warmed, e.g. when the warmup got cancelled, get no last call
+func (r *progressReporter) stop() {
+	close(r.stopped)
+	<-r.exited
+}
+
+func (r *progressReporter) run() {
+	defer close(r.exited)
+	ticker := time.NewTicker(progressReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stopped:
+			r.report(false)
+			return
+		case <-r.wake:
+			r.report(false)
+		case <-ticker.C:
+			r.report(true)
+		}
+	}
+}
+
+// report makes the last call of the files that finished, and with active a call for each file being warmed
+func (r *progressReporter) report(active bool) {
+	r.mu.Lock()
+	done := r.done
+	r.done = nil
+	var files []*fileProgress
+	if active {
+		files = make([]*fileProgress, 0, len(r.active))
+		for p := range r.active {
+			files = append(files, p)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, p := range done {
+		progress := p.progress()
+		progress.Done = true
+		r.onProgress(progress)
+	}
+	for _, p := range files {
+		r.onProgress(p.progress())
+	}
+}
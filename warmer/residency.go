@@ -0,0 +1,76 @@
+package warmer
+
+import (
+	"errors"
+	"os"
+)
+
+// FileResidency is how much of a file was in page cache when measured
+type FileResidency struct {
+	Path          string `json:"path"`
+	SizeBytes     int64  `json:"size_bytes"`
+	ResidentBytes int64  `json:"resident_bytes"`
+}
+
+// The least significant bit of each mincore entry is set for resident pages
+func allResident(residency []byte) bool {
+	for _, page := range residency {
+		if page&1 == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// residentBlocks reports for every block of the file if all of its pages are in page cache
+func residentBlocks(file *os.File, size int64, blockSize int64) ([]bool, error) {
+	residency, err := pageResidency(file, size)
+	if err != nil {
+		return nil, err
+	}
+
+	pageSize := int64(os.Getpagesize())
+	blocks := make([]bool, (size+blockSize-1)/blockSize)
+	for i := range blocks {
+		firstPage := int64(i) * blockSize / pageSize
+		lastPage := (min(int64(i+1)*blockSize, size) - 1) / pageSize
+		blocks[i] = allResident(residency[firstPage : lastPage+1])
+	}
+	return blocks, nil
+}
+
+// Residency measures how much of every file is in page cache, e.g. before and after a warmup to see it worked
+// Files that can't be measured are left out, their errors are joined
+func Residency(filePaths []string) ([]FileResidency, error) {
+	var errs []error
+	var residencies []FileResidency
+	pageSize := int64(os.Getpagesize())
+	for _, filePath := range filePaths {
+		file, err := os.Open(filePath)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		residency := FileResidency{Path: filePath}
+		info, err := file.Stat()
+		var pages []byte
+		if err == nil {
+			residency.SizeBytes = info.Size()
+			pages, err = pageResidency(file, residency.SizeBytes)
+		}
+		file.Close()
+		if err != nil {
+			errs = append(errs, &os.PathError{Op: "mincore", Path: filePath, Err: err})
+			continue
+		}
+
+		for i, page := range pages {
+			if page&1 != 0 {
+				// The last page only holds the rest of the file
+				residency.ResidentBytes += min(pageSize, residency.SizeBytes-int64(i)*pageSize)
+			}
+		}
+		residencies = append(residencies, residency)
+	}
+	return residencies, errors.Join(errs...)
+}
@@ -0,0 +1,46 @@
+//go:build linux
+
+package warmer
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// mincore reports which pages of a mapping are resident in page cache
+// One entry per page, golang.org/x/sys/unix has no wrapper for it on Linux
+// https://man7.org/linux/man-pages/man2/mincore.2.html
+func mincore(data []byte, residency []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	_, _, errno := unix.Syscall(unix.SYS_MINCORE, uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)), uintptr(unsafe.Pointer(&residency[0])))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// pageResidency returns the mincore entry of every page of the file
+func pageResidency(file *os.File, size int64) ([]byte, error) {
+	fd := int(file.Fd())
+	pageSize := int64(os.Getpagesize())
+	residency := make([]byte, (size+pageSize-1)/pageSize)
+
+	// Map window by window like madviseWillNeed, huge files don't need a huge mapping
+	for offset := int64(0); offset < size; offset += mmapWindowSize {
+		length := min(mmapWindowSize, size-offset)
+		data, err := unix.Mmap(fd, offset, int(length), unix.PROT_READ, unix.MAP_SHARED)
+		if err != nil {
+			return nil, err
+		}
+		err = mincore(data, residency[offset/pageSize:])
+		unix.Munmap(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return residency, nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package warmer
+
+import (
+	"errors"
+	"os"
+)
+
+func pageResidency(file *os.File, size int64) ([]byte, error) {
+	return nil, errors.New("page cache residency is only supported on Linux")
+}
@@ -0,0 +1,55 @@
+package warmer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"syscall"
+	"time"
+)
+
+// Reads failing with a transient error are retried this often by default
+const DefaultReadRetries = 3
+
+// Backoff before the first retry, doubled for every further one
+const (
+	retryInitialBackoff = 50 * time.Millisecond
+	retryMaxBackoff     = 5 * time.Second
+)
+
+// Reads interrupted by a signal are tried again right away, this many times at most
+// They don't count as retries, nothing went wrong with the read itself
+const maxInterruptedReads = 16
+
+// Network attached lazy filesystems fail reads now and then while fetching from the backing store
+// O_DIRECT reads can fail with ENOMEM under memory pressure, they're likely to work a bit later
+func isTransientReadError(err error) bool {
+	return errors.Is(err, syscall.EIO) || errors.Is(err, syscall.ETIMEDOUT) || errors.Is(err, syscall.ENOMEM)
+}
+
+// readWithRetries calls read until it succeeds, fails permanently or retries are exhausted
+// Every attempt reads the whole range again, the bytes of the last attempt are returned
+// path and offset only describe the read in the log
+func readWithRetries(ctx context.Context, retries int, logger *Logger, path string, offset int64, read func() (int, error)) (int, error) {
+	backoff := retryInitialBackoff
+	interrupted := 0
+	for attempt := 0; ; attempt++ {
+		n, err := read()
+		if errors.Is(err, syscall.EINTR) && interrupted < maxInterruptedReads {
+			interrupted++
+			attempt--
+			continue
+		}
+		if err == nil || err == io.EOF || !isTransientReadError(err) || attempt >= retries {
+			return n, err
+		}
+
+		logger.Debugf("Retrying read at offset %d of %s in %v: %v\n", offset, path, backoff, err)
+		select {
+		case <-ctx.Done():
+			return n, err
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, retryMaxBackoff)
+	}
+}
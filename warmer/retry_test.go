@@ -0,0 +1,87 @@
+package warmer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// failingRead fails with the errors in turn, then reads n bytes
+func failingRead(n int, errs ...error) (func() (int, error), *int) {
+	calls := 0
+	return func() (int, error) {
+		calls++
+		if calls <= len(errs) {
+			return 0, errs[calls-1]
+		}
+		return n, nil
+	}, &calls
+}
+
+func TestReadWithRetries(t *testing.T) {
+	logger := NewLogger(io.Discard, LevelError)
+	tests := []struct {
+		name    string
+		retries int
+		errs    []error
+		want    error
+		calls   int
+		// Sum of the backoffs waited for before the last attempt
+		backoff time.Duration
+	}{
+		{"succeeds at once", 3, nil, nil, 1, 0},
+		{"retries ENOMEM with backoff", 3, []error{syscall.ENOMEM, syscall.ENOMEM}, nil, 3, retryInitialBackoff * 3},
+		{"retries EIO", 1, []error{syscall.EIO}, nil, 2, retryInitialBackoff},
+		{"gives up once retries are exhausted", 2, []error{syscall.EIO, syscall.ETIMEDOUT, syscall.EIO}, syscall.EIO, 3, retryInitialBackoff * 3},
+		{"no retries", 0, []error{syscall.ENOMEM}, syscall.ENOMEM, 1, 0},
+		{"EINTR is read again right away", 0, []error{syscall.EINTR, syscall.EINTR}, nil, 3, 0},
+		{"EINTR doesn't use up retries", 1, []error{syscall.EINTR, syscall.ENOMEM, syscall.EINTR}, nil, 4, retryInitialBackoff},
+		{"EINTR is read again a bounded number of times", 3, repeatErr(syscall.EINTR, maxInterruptedReads+1), syscall.EINTR, maxInterruptedReads + 1, 0},
+		{"gives up on a permanent errno", 3, []error{syscall.EBADF}, syscall.EBADF, 1, 0},
+		{"gives up on a permanent errno after retrying", 3, []error{syscall.EIO, syscall.EINVAL}, syscall.EINVAL, 2, retryInitialBackoff},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			read, calls := failingRead(4096, test.errs...)
+			start := time.Now()
+			n, err := readWithRetries(context.Background(), test.retries, logger, "file", 0, read)
+			elapsed := time.Since(start)
+			if !errors.Is(err, test.want) || (err == nil) != (test.want == nil) {
+				t.Fatalf("readWithRetries = %v, want %v", err, test.want)
+			}
+			if err == nil && n != 4096 {
+				t.Fatalf("readWithRetries read %d bytes, want 4096", n)
+			}
+			if *calls != test.calls {
+				t.Fatalf("read was called %d times, want %d", *calls, test.calls)
+			}
+			if elapsed < test.backoff {
+				t.Fatalf("readWithRetries took %v, want a backoff of at least %v", elapsed, test.backoff)
+			}
+			if test.backoff == 0 && elapsed > retryInitialBackoff {
+				t.Fatalf("readWithRetries took %v without backing off", elapsed)
+			}
+		})
+	}
+}
+
+func TestReadWithRetriesStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	read, calls := failingRead(4096, syscall.EIO, syscall.EIO)
+	cancel()
+	_, err := readWithRetries(ctx, 3, NewLogger(io.Discard, LevelError), "file", 0, read)
+	if !errors.Is(err, syscall.EIO) || *calls != 1 {
+		t.Fatalf("readWithRetries = %v after %d reads, want the EIO of the first read", err, *calls)
+	}
+}
+
+func repeatErr(err error, n int) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
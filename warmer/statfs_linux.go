@@ -0,0 +1,38 @@
+//go:build linux
+
+package warmer
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// Names of common filesystems, by the magic number statfs reports
+// https://man7.org/linux/man-pages/man2/statfs.2.html
+var filesystemNames = map[int64]string{
+	unix.TMPFS_MAGIC:           "tmpfs",
+	unix.FUSE_SUPER_MAGIC:      "fuse",
+	unix.OVERLAYFS_SUPER_MAGIC: "overlayfs",
+	unix.PROC_SUPER_MAGIC:      "proc",
+	unix.SYSFS_MAGIC:           "sysfs",
+	unix.RAMFS_MAGIC:           "ramfs",
+	unix.NFS_SUPER_MAGIC:       "nfs",
+	unix.CIFS_SUPER_MAGIC:      "cifs",
+	unix.SQUASHFS_MAGIC:        "squashfs",
+	unix.EXT4_SUPER_MAGIC:      "ext4",
+	unix.XFS_SUPER_MAGIC:       "xfs",
+	unix.BTRFS_SUPER_MAGIC:     "btrfs",
+}
+
+// filesystemType names the filesystem path lives on, or gives its magic number when it's not a known one
+func filesystemType(path string) string {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return "unknown filesystem"
+	}
+	if name, ok := filesystemNames[int64(stat.Type)]; ok {
+		return name
+	}
+	return fmt.Sprintf("filesystem %#x", stat.Type)
+}
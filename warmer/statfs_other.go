@@ -0,0 +1,8 @@
+//go:build !linux
+
+package warmer
+
+// Only Linux opens files with O_DIRECT, elsewhere a failed open has nothing to do with the filesystem
+func filesystemType(path string) string {
+	return "unknown filesystem"
+}
@@ -0,0 +1,103 @@
+package warmer
+
+import "time"
+
+// Result summarizes a warmup run, including a cancelled one
+type Result struct {
+	TotalBytes    int64   `json:"total_bytes"`
+	TotalSeconds  float64 `json:"total_seconds"`
+	ThroughputMBs float64 `json:"throughput_mb_s"`
+	FileCount     int     `json:"file_count"`
+	SkippedBlocks int64   `json:"skipped_blocks"`
+	// Blocks of sparse files left out with SkipHoles
+	HoleBlocks   int64 `json:"hole_blocks"`
+	FailedBlocks int64 `json:"failed_blocks"`
+	FailedFiles  int   `json:"failed_files"`
+	// Failed files that ran into the per file timeout
+	TimedOutFiles int `json:"timed_out_files"`
+	// Files deleted while they were read, not counted as failed files
+	RemovedFiles int `json:"removed_files"`
+	// Files read short of their bytes without a failed read, only counted as failed with Options.Strict
+	PartialFiles int   `json:"partial_files"`
+	MissingBytes int64 `json:"missing_bytes"`
+	// Files read fine whose checksum didn't match, not counted as failed files
+	ChecksumMismatches int `json:"checksum_mismatches"`
+	// Latencies of the reads of all files, with Options.Histogram
+	Latency *LatencyStats `json:"latency,omitempty"`
+	// The failed files with their error, in input order, to know what to retry
+	Failures []Failure  `json:"failures"`
+	Files    []FileStat `json:"files"`
+}
+
+// Failure is a file that couldn't be warmed
+type Failure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// FileStat is the outcome of a single file
+type FileStat struct {
+	Path            string  `json:"path"`
+	SizeBytes       int64   `json:"size_bytes"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	ThroughputMBs   float64 `json:"throughput_mb_s"`
+	Error           string  `json:"error,omitempty"`
+	// Set when the file was given up on after the per file timeout
+	TimedOut bool `json:"timed_out,omitempty"`
+	// Set when the file was deleted while it was read, the rest of it wasn't read
+	Removed bool `json:"removed,omitempty"`
+	// Bytes to warm that weren't read though no read failed, the file was only partially warmed
+	MissingBytes int64 `json:"missing_bytes,omitempty"`
+	// Offsets of blocks that couldn't be read after retrying
+	FailedBlocks []int64 `json:"failed_blocks,omitempty"`
+	// Result of the checksum verification, empty when the file wasn't verified
+	Verify string `json:"verify,omitempty"`
+	// Latencies of the reads of the file, with Options.Histogram
+	Latency *LatencyStats `json:"latency,omitempty"`
+}
+
+// LatencyStats is the distribution of read latencies, each read covers a run of BlocksPerRead blocks
+// Percentiles are rounded up to the next power of two microseconds
+type LatencyStats struct {
+	Reads int64   `json:"reads"`
+	P50Ms float64 `json:"p50_ms"`
+	P90Ms float64 `json:"p90_ms"`
+	P99Ms float64 `json:"p99_ms"`
+	MaxMs float64 `json:"max_ms"`
+}
+
+func newResult(files []FileStat, bytesRead int64, duration time.Duration) Result {
+	stats := Result{
+		TotalBytes:   bytesRead,
+		TotalSeconds: duration.Seconds(),
+		FileCount:    len(files),
+		Files:        files,
+		Failures:     []Failure{},
+	}
+	if stats.Files == nil {
+		stats.Files = []FileStat{}
+	}
+	for _, file := range files {
+		if file.Error != "" {
+			stats.FailedFiles++
+			stats.Failures = append(stats.Failures, Failure{Path: file.Path, Error: file.Error})
+		}
+		if file.TimedOut {
+			stats.TimedOutFiles++
+		}
+		if file.Removed {
+			stats.RemovedFiles++
+		}
+		if file.MissingBytes > 0 {
+			stats.PartialFiles++
+			stats.MissingBytes += file.MissingBytes
+		}
+		if file.Verify == VerifyMismatch {
+			stats.ChecksumMismatches++
+		}
+	}
+	if duration > 0 {
+		stats.ThroughputMBs = float64(bytesRead) / 1024 / 1024 / duration.Seconds()
+	}
+	return stats
+}
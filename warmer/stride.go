@@ -0,0 +1,67 @@
+package warmer
+
+// spanList is the order the blocks of a file are dispatched in, span after span
+type spanList interface {
+	len() int
+	at(i int) blockSpan
+}
+
+// blockSpans are spans worked out up front, e.g. ordered by physical offset
+type blockSpans []blockSpan
+
+func (s blockSpans) len() int           { return len(s) }
+func (s blockSpans) at(i int) blockSpan { return s[i] }
+
+// joinedSpans are the spans of several regions of a file, e.g. its head and its tail, one region after the other
+type joinedSpans []spanList
+
+func (s joinedSpans) len() int {
+	n := 0
+	for _, spans := range s {
+		n += spans.len()
+	}
+	return n
+}
+
+func (s joinedSpans) at(i int) blockSpan {
+	for _, spans := range s {
+		if i < spans.len() {
+			return spans.at(i)
+		}
+		i -= spans.len()
+	}
+	panic("span index out of range")
+}
+
+// stridedSpans splits the blocks from first to end into a region per stream, and hands out runs of the regions round robin
+// Reads in flight at the same time are then a region apart, instead of all next to each other
+// Computed on the fly, a huge file would need millions of spans
+type stridedSpans struct {
+	first, end int64
+	streams    int64
+	// Blocks per region and per run
+	region, run int64
+}
+
+// newStridedSpans interleaves streams regions, in runs of up to run blocks
+func newStridedSpans(first, end int64, streams int, run int) stridedSpans {
+	s := stridedSpans{first: first, end: end, streams: int64(max(streams, 1)), run: int64(max(run, 1))}
+	// Regions are whole runs, only the last one may be shorter
+	s.region = (end - first + s.streams - 1) / s.streams
+	s.region = (s.region + s.run - 1) / s.run * s.run
+	return s
+}
+
+func (s stridedSpans) len() int {
+	if s.region == 0 {
+		return 0
+	}
+	return int(s.streams * (s.region / s.run))
+}
+
+// Runs past the end of the blocks are empty, they are just skipped
+func (s stridedSpans) at(i int) blockSpan {
+	round, stream := int64(i)/s.streams, int64(i)%s.streams
+	start := min(s.first+stream*s.region+round*s.run, s.end)
+	return blockSpan{start: start, end: min(start+s.run, s.end)}
+}
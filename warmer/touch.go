@@ -0,0 +1,38 @@
+package warmer
+
+import "io"
+
+// Bytes read from every block with TouchOnly and O_DIRECT
+// directIOAlignment is enough for most disks, 4K sector drives refuse anything below 4096 though
+const directTouchSize int64 = 4096
+
+// touchSize is how much of every block TouchOnly reads, the least a read of the file may be
+// Through page cache a single byte does, the kernel reads at least the page around it anyway
+func touchSize(blockSize int64, buffered bool) int64 {
+	if buffered {
+		return 1
+	}
+	return min(directTouchSize, blockSize)
+}
+
+// touchBlocks reads from the start of each block of the run into buffer, enough to make the backing store fetch it
+// Returns the bytes of the blocks touched up to size, like a read of the whole run would
+func touchBlocks(r fileReader, buffer []byte, offset int64, blocks int, blockSize int64, size int64) (int, error) {
+	var touched int64
+	for i := 0; i < blocks; i++ {
+		blockOffset := offset + int64(i)*blockSize
+		if blockOffset >= size {
+			return int(touched), io.EOF
+		}
+		n, err := preadFull(r, buffer, blockOffset)
+		if err != nil {
+			return int(touched), err
+		}
+		if n == 0 {
+			// The file got shorter since it was opened
+			return int(touched), io.EOF
+		}
+		touched += min(blockSize, size-blockOffset)
+	}
+	return int(touched), nil
+}
@@ -0,0 +1,156 @@
+package warmer
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Outcome of verifying a file against its expected checksum
+const (
+	VerifyOK       = "ok"
+	VerifyMismatch = "mismatch"
+	// Some blocks couldn't be read, so there is nothing to compare
+	VerifyIncomplete = "incomplete"
+)
+
+// fileHasher hashes the blocks of a file in order while workers read them out of order
+// Runs arriving early are kept until the gap before them is filled
+// Dispatch is in order, so only about as many runs as are in flight get buffered
+type fileHasher struct {
+	mu      sync.Mutex
+	hash    hash.Hash
+	next    int64
+	pending map[int64][]byte
+	broken  bool
+	// Only bytes from up to to are hashed, to of -1 means up to the end of file
+	from int64
+	to   int64
+}
+
+func newFileHasher() *fileHasher {
+	return &fileHasher{hash: sha256.New(), pending: make(map[int64][]byte), to: -1}
+}
+
+// restrict hashes only the bytes of the range, reads start at the block boundary start before it
+func (h *fileHasher) restrict(start int64, byteRange ByteRange) {
+	h.next = start
+	h.from = byteRange.Offset
+	if byteRange.Length > 0 {
+		h.to = byteRange.Offset + byteRange.Length
+	}
+}
+
+// add hashes the part of data read at h.next that lies in the range
+func (h *fileHasher) add(data []byte) {
+	lo, hi := max(h.from-h.next, 0), int64(len(data))
+	if h.to >= 0 {
+		hi = min(hi, h.to-h.next)
+	}
+	if lo < hi {
+		h.hash.Write(data[lo:hi])
+	}
+	h.next += int64(len(data))
+}
+
+// write takes the first n bytes read into buffers starting at offset
+func (h *fileHasher) write(offset int64, buffers [][]byte, n int) {
+	if n <= 0 {
+		// Past the end of file, nothing to hash
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if offset != h.next {
+		// Buffers are reused by the worker right away, keep a copy
+		data := make([]byte, 0, n)
+		for _, buffer := range buffers {
+			data = append(data, buffer[:min(len(buffer), n-len(data))]...)
+		}
+		h.pending[offset] = data
+		return
+	}
+
+	remaining := n
+	for _, buffer := range buffers {
+		chunk := buffer[:min(len(buffer), remaining)]
+		h.add(chunk)
+		remaining -= len(chunk)
+	}
+
+	// Drain runs that were waiting for this one
+	for {
+		data, ok := h.pending[h.next]
+		if !ok {
+			break
+		}
+		delete(h.pending, h.next)
+		h.add(data)
+	}
+}
+
+// fail marks the hash as unusable, a block is missing from it
+func (h *fileHasher) fail() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.broken = true
+}
+
+// verify compares the hash of the whole file, or its range, against the expected sum
+func (h *fileHasher) verify(size int64, expected []byte) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	end := size
+	if h.to >= 0 {
+		end = min(h.to, size)
+	}
+	if h.broken || h.next < end {
+		return VerifyIncomplete
+	}
+	if !bytes.Equal(h.hash.Sum(nil), expected) {
+		return VerifyMismatch
+	}
+	return VerifyOK
+}
+
+// ReadChecksums parses a manifest in the format written by sha256sum
+// Each line holds a hex digest and a path, an asterisk before the path marks binary mode and is ignored
+func ReadChecksums(name string) (map[string][]byte, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	checksums := make(map[string][]byte)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		digest, path, ok := strings.Cut(text, " ")
+		path = strings.TrimPrefix(strings.TrimLeft(path, " "), "*")
+		if !ok || path == "" {
+			return nil, fmt.Errorf("%s:%d: expected a digest and a path", name, line)
+		}
+		sum, err := hex.DecodeString(digest)
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("%s:%d: invalid sha256 digest %q", name, line, digest)
+		}
+		checksums[filepath.Clean(path)] = sum
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return checksums, nil
+}
@@ -0,0 +1,952 @@
+// Package warmer reads files block by block to pull them from slow or lazily loaded storage
+// It backs the fwup CLI and the python wrapper, and can be embedded in other programs
+package warmer
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/time/rate"
+)
+
+// const blockSize int64 = 1024 * 256          // 256 KB
+// const psyncWorkersCount int = 4             // Number of workers
+// const smallFileSize int64 = 1024 * 1024 * 2 // 2MB
+
+// FileIOMethod picks how blocks are read, see Options.Method
+type FileIOMethod string
+
+const (
+	PosixSync FileIOMethod = "psync"
+	IOUring   FileIOMethod = "io_uring"
+	// Populate page cache block by block with readahead(2), no data is copied to userspace
+	ReadAhead FileIOMethod = "readahead"
+	// Ask the kernel to prefetch with FADV_WILLNEED instead of reading blocks
+	WillNeed FileIOMethod = "willneed"
+	// Map the file and ask the kernel to prefetch with MADV_WILLNEED
+	Mmap FileIOMethod = "mmap"
+)
+
+// FileOrder picks the order files are warmed in, see Options.Order
+type FileOrder string
+
+const (
+	// Warm files in the order they were given
+	OrderInput FileOrder = "input"
+	// Start with the largest files, so no long read is left for the end when workers idle
+	OrderSizeDesc FileOrder = "size-desc"
+)
+
+// FadviseHint is the access pattern announced with posix_fadvise before a file is read
+type FadviseHint string
+
+const (
+	// Ramp up readahead, the default
+	HintSequential FadviseHint = "sequential"
+	// Disable readahead
+	HintRandom FadviseHint = "random"
+	// The kernel default readahead
+	HintNormal FadviseHint = "normal"
+)
+
+// Options controls how the files are warmed
+type Options struct {
+	// One of the built in methods or a backend registered with RegisterBackend
+	Method                 FileIOMethod
+	SmallFileSizeThreshold int64
+	BlockSizeForSmallFiles int64
+	BlockSizeForLargeFiles int64
+	SmallFilesWorkerCount  int
+	LargeFilesWorkerCount  int
+	// Order files are warmed in, empty means OrderInput
+	Order FileOrder
+	// Files of a group warmed at the same time, each with its own workers, 0 means 1
+	FileConcurrency int
+	// Files on the same device warmed at the same time, at most FileConcurrency, 0 means no limit
+	PerDiskConcurrency int
+	// Give the large files of every device a pool of this many workers, instead of LargeFilesWorkerCount shared by all
+	// Devices are warmed at the same time, so a JBOD scales with its disks, 0 means a single pool
+	WorkersPerDisk int
+	// How the blocks of the files of a lane are handed to its workers, empty means DispatchSequential
+	// DispatchInterleave warms all files a lane may take at once, instead of one after the other
+	// DispatchWeighted does too, but favors small files so they finish early while large ones go on in the background
+	Dispatch DispatchMode
+	// Consecutive blocks handed to a worker at once, psync reads them with a single preadv
+	BlocksPerRead int
+	// Dispatch the blocks of a file in a stream per worker, each over its own region of the file, so reads in flight are far apart
+	// Suits HDDs and striped backends, where reads next to each other contend for the same disk or stripe
+	Stride bool
+	// Order the blocks of a file are read in, empty means PatternSequential
+	// PatternRandom reads runs of BlocksPerRead blocks shuffled, to warm a cache the way a random access consumer reads
+	Pattern ReadPattern
+	// Picks the order of PatternRandom, the same seed reads a file in the same order
+	Seed int64
+	// Find the read size per file, starting at a single block and doubling while the throughput improves
+	// Reads grow up to 16MB or BlocksPerRead blocks if that's more, always whole blocks so O_DIRECT stays aligned
+	Adaptive bool
+	// With WillNeed, poll until the whole file is resident in page cache
+	WaitResident bool
+	// With Mmap, touch one byte per page after advising, for kernels deferring the fetch of MADV_WILLNEED
+	MmapPopulate bool
+	// Only read blocks that aren't fully resident in page cache yet, e.g. after an interrupted run
+	SkipCached bool
+	// Only read blocks holding data, the holes of sparse files are left out
+	SkipHoles bool
+	// Read through page cache instead of with O_DIRECT, so the data stays cached for later opens
+	NoDirect bool
+	// Fail files on filesystems refusing O_DIRECT, instead of reading them through page cache
+	DirectOnly bool
+	// Read just the start of every block, for backing stores fetching whole blocks however little is read
+	// That's 4096 bytes with O_DIRECT, or the block size if smaller, and a single byte through page cache
+	// Blocks touched count as read in full, the bytes read are what the backing store was asked to fetch
+	TouchOnly bool
+	// Drop every run from page cache right after reading it, only fetching the files into the backing store
+	// Applies to files read through page cache, O_DIRECT reads leave nothing behind to drop
+	EvictAfter bool
+	// Access pattern announced before reading through page cache, empty means HintSequential
+	// Not used with O_DIRECT, no readahead happens there
+	FadviseHint FadviseHint
+	// Read the blocks of a file in the order they lie on disk, found with FIEMAP, instead of by offset
+	// Saves seeks on spinning disks with fragmented files, falls back to logical order without FIEMAP
+	PhysicalOrder bool
+	// Expected sha256 of files by cleaned path, the ones listed are verified while reading
+	// For a file with a range in Ranges, the checksum is the one of the bytes of the range
+	Checksums map[string][]byte
+	// Byte ranges by cleaned path, only these parts of the listed files are warmed
+	Ranges map[string]ByteRange
+	// Only the first Head bytes of the files without a range in Ranges are warmed, rounded up to a block, 0 means all
+	Head int64
+	// Only the last Tail bytes of the files without a range in Ranges are warmed, from a block boundary, 0 means all
+	// With Head as well both ends are warmed, the middle is left out
+	Tail int64
+	// Cap of the combined read rate of all workers in bytes per second, 0 means unlimited
+	MaxRate int64
+	// I/O scheduling priority of the workers, e.g. IOPriorityIdle to stay out of the way of other workloads
+	IOPriority IOPriority
+	// Lock every worker to a CPU of its own, so workers don't migrate between cores while benchmarking
+	// Workers outnumbering the CPUs the process may run on share them, Linux only
+	PinCPUs bool
+	// Times a block failing with a transient error is read again, with exponential backoff
+	Retries int
+	// A file taking longer is given up on and marked as timed out, 0 means no limit
+	// Its remaining blocks aren't read, other files go on
+	FileTimeout time.Duration
+	// A file is given up on after this many of its blocks failed in a row, 0 means all blocks are tried
+	MaxFileErrors int
+	// Stop the whole warmup at the first file that fails, by default the others are still warmed
+	Strict bool
+	// Cap of the buffer memory of all workers in bytes, worker counts are lowered to fit, 0 means no cap
+	// Every worker holds BlocksPerRead buffers of its block size, io_uring workers also up to 16MB for their ring
+	MaxMemory int64
+	// MaxMemory is a target rather than a limit, when a single worker per group doesn't fit it's used anyway, with a warning
+	// For a cap derived from the environment, where failing would break runs that worked without it
+	MaxMemoryBestEffort bool
+	// Record the latency of every read, for the percentiles in the per file and overall stats
+	Histogram bool
+	// Files opened at a time, 0 means half the soft limit of open files
+	OpenBatch int
+	// Progress and errors are logged here, stdout by default
+	Logger *Logger
+	// Updated while the warmup runs, when the caller wants to watch progress
+	Counters *Counters
+	// Workers are taken from the pool and handed back when done, for the next warmup given it (default: workers of their own)
+	Pool *Pool
+	// Called every second for each file being warmed, and once more when a file is done
+	// Calls come from a single goroutine, one at a time, and none after Warm returns
+	// Reads don't wait for it, but a slow callback delays the calls for other files
+	OnProgress func(FileProgress)
+}
+
+// Logical sector size that O_DIRECT reads must be aligned to
+const directIOAlignment int64 = 512
+
+// Files opened at a time when the limit of open files is unknown, and at most by default
+// Batches end with the tail of their slowest file, so they shouldn't be needlessly small either
+const (
+	fallbackOpenBatch = 512
+	maxOpenBatch      = 16384
+)
+
+// fileReadRequest covers a run of consecutive blocks starting at offset
+type fileReadRequest struct {
+	fd       int
+	offset   int64
+	blocks   int
+	progress *fileProgress
+}
+
+// Warm warms the files as configured by opts and reports per file stats
+// Failures of single files don't stop the others, they are returned together as a *WarmError
+// Dispatching stops once ctx is cancelled, blocks already being read are finished
+// The result then covers what was done so far
+func Warm(ctx context.Context, filePaths []string, opts Options) (Result, error) {
+	var logger = opts.Logger
+	if logger == nil {
+		logger = NewLogger(os.Stdout, LevelInfo)
+	}
+
+	opts.setDefaults()
+	if err := opts.Validate(); err != nil {
+		return Result{}, err
+	}
+
+	// Kernels older than 5.1 (or with io_uring disabled) can still be warmed with psync
+	// Blocks are split the same way, so the throughput stays comparable
+	if opts.Method == IOUring {
+		if err := probeIOUring(); err != nil {
+			logger.Warnf("io_uring is not available, falling back to psync: %v\n", err)
+			opts.Method = PosixSync
+		}
+	}
+
+	if err := capMemory(&opts, logger); err != nil {
+		return Result{}, err
+	}
+
+	// Warming a file twice only costs I/O and counts its bytes twice
+	filePaths, infos, duplicates := dedupePaths(filePaths)
+	if duplicates > 0 {
+		logger.Infof("Skipping %d duplicate paths\n", duplicates)
+	}
+
+	if len(filePaths) == 0 {
+		logger.Infof("No files to warmup\n")
+		return newResult(nil, 0, 0), nil
+	}
+
+	// Failures of individual files don't stop the others from being warmed
+	// They are all reported together at the end
+	var errs []error
+
+	// Bytes actually read, so stats stay accurate when cancelled midway
+	var counters = opts.Counters
+	if counters == nil {
+		counters = &Counters{}
+	}
+	var startTime = time.Now()
+	counters.FilesTotal.Add(int64(len(filePaths)))
+	// Counters may be shared by several warmups, e.g. repeated runs, the result only covers this one
+	bytesReadBefore := counters.BytesRead.Load()
+	skippedBefore, holesBefore, failedBefore := counters.BlocksSkipped.Load(), counters.BlocksHoles.Load(), counters.BlocksFailed.Load()
+
+	// A single limiter shared by all batches and groups, so the cap holds for the whole warmup
+	// The burst has to fit the largest read a worker waits for at once
+	var limiter *rate.Limiter
+	if opts.MaxRate > 0 {
+		burst := max(opts.BlockSizeForSmallFiles*int64(opts.readBlocks(opts.BlockSizeForSmallFiles)), opts.BlockSizeForLargeFiles*int64(opts.readBlocks(opts.BlockSizeForLargeFiles)))
+		limiter = rate.NewLimiter(rate.Limit(opts.MaxRate), int(burst))
+	}
+
+	// A single pinner, so the CPUs are handed out once for the whole warmup
+	var pinner *cpuPinner
+	if opts.PinCPUs {
+		var err error
+		pinner, err = newCPUPinner()
+		if err != nil {
+			return Result{}, fmt.Errorf("pin workers to CPUs: %w", err)
+		}
+		logger.Infof("Pinning workers to the %d CPUs available\n", len(pinner.cpus))
+	}
+
+	// Fail fast, the cause shows up as the reason the warmup got cancelled
+	var onFail func(error)
+	if opts.Strict {
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+		onFail = func(err error) {
+			cancel(fmt.Errorf("stopped at the first failure: %w", err))
+		}
+	}
+
+	// Files are opened a batch at a time, so huge lists stay below the limit of open files
+	batchSize := opts.OpenBatch
+	if batchSize == 0 {
+		batchSize = defaultOpenBatch()
+	}
+	var reporter *progressReporter
+	if opts.OnProgress != nil {
+		reporter = newProgressReporter(opts.OnProgress)
+	}
+	var progresses []*fileProgress
+	for start := 0; start < len(filePaths) && ctx.Err() == nil; start += batchSize {
+		end := min(start+batchSize, len(filePaths))
+		if batchSize < len(filePaths) {
+			logger.Debugf("Warming up files %d to %d of %d\n", start+1, end, len(filePaths))
+		}
+		batch, err := warmBatch(ctx, filePaths[start:end], infos[start:end], opts, limiter, pinner, onFail, reporter, counters, logger)
+		progresses = append(progresses, batch...)
+		errs = append(errs, err)
+	}
+	if reporter != nil {
+		reporter.stop()
+	}
+
+	// The cause tells why, e.g. the signal that stopped the warmup
+	if ctx.Err() != nil {
+		err := context.Cause(ctx)
+		logger.Warnf("Warmup cancelled: %v\n", err)
+		errs = append(errs, err)
+	}
+
+	fileStats := make([]FileStat, len(progresses))
+	var latencies *latencyHistogram
+	var fileErrs []FileError
+	for i, progress := range progresses {
+		fileStats[i] = progress.stat()
+		// The workers are all done, nothing records latencies anymore
+		if progress.latencies != nil {
+			if latencies == nil {
+				latencies = &latencyHistogram{}
+			}
+			latencies.merge(progress.latencies)
+		}
+		if err := progress.failure(); err != nil {
+			fileErrs = append(fileErrs, FileError{Path: progress.path, Err: err})
+		}
+		if fileStats[i].MissingBytes > 0 {
+			logger.Warnf("%s was only partially warmed, %d bytes weren't read\n", progress.path, fileStats[i].MissingBytes)
+		}
+		// Mismatches are reported apart from read errors, the file itself was warmed fine
+		if fileStats[i].Verify == VerifyMismatch {
+			logger.Errorf("Checksum mismatch: %s\n", progress.path)
+			fileErrs = append(fileErrs, FileError{Path: progress.path, Err: ErrChecksumMismatch})
+		}
+	}
+	stats := newResult(fileStats, counters.BytesRead.Load()-bytesReadBefore, time.Since(startTime))
+	stats.SkippedBlocks = counters.BlocksSkipped.Load() - skippedBefore
+	stats.HoleBlocks = counters.BlocksHoles.Load() - holesBefore
+	stats.FailedBlocks = counters.BlocksFailed.Load() - failedBefore
+	if latencies != nil {
+		latency := latencies.stats()
+		stats.Latency = &latency
+	}
+	// Everything that went wrong in the batches is the error of a file, apart from the cause of a cancelled warmup
+	if len(fileErrs) > 0 {
+		var other []error
+		if ctx.Err() != nil {
+			other = append(other, context.Cause(ctx))
+		}
+		return stats, &WarmError{files: fileErrs, other: other}
+	}
+	return stats, errors.Join(errs...)
+}
+
+// warmBatch opens the files and warms them, they are all closed again once it returns
+// infos are what dedupePaths found for the paths, nil for the ones it couldn't stat
+// Every path gets an entry in the returned progresses, unless ctx got cancelled before it was opened
+func warmBatch(ctx context.Context, filePaths []string, infos []os.FileInfo, opts Options, limiter *rate.Limiter, pinner *cpuPinner, onFail func(error), reporter *progressReporter, counters *Counters, logger *Logger) ([]*fileProgress, error) {
+	var errs []error
+
+	// Every input path gets an entry, so failures show up in the per file stats too
+	var progresses []*fileProgress
+	var files []*fileProgress
+	// Filesystems files were opened without O_DIRECT on, only the first file of each is worth a warning
+	directFallbacks := make(map[string]bool)
+	for i, filePath := range filePaths {
+		if ctx.Err() != nil {
+			break
+		}
+
+		// Opening a FIFO waits for a writer, so the type is checked on the path first
+		// A path that couldn't be stat'ed is still opened, for the error to show up like other open errors
+		if info := infos[i]; info != nil && !isWarmable(info.Mode()) {
+			logger.Warnf("Skipping %s, it's a %s and not a regular file or block device\n", filePath, fileType(info.Mode()))
+			counters.FilesTotal.Add(-1)
+			continue
+		}
+
+		progress := &fileProgress{path: filePath, counters: counters, onFail: onFail, reporter: reporter, maxErrors: opts.MaxFileErrors}
+		progresses = append(progresses, progress)
+		if opts.Checksums != nil {
+			if sum, ok := opts.Checksums[filepath.Clean(filePath)]; ok {
+				progress.hasher = newFileHasher()
+				progress.expectedSum = sum
+			} else {
+				logger.Warnf("No checksum for %s, not verifying it\n", filePath)
+			}
+		}
+		if byteRange, ok := opts.rangeOf(filePath); ok {
+			progress.byteRange = &byteRange
+		}
+		progress.tail = opts.tailOf(filePath)
+
+		var file *os.File
+		var err error
+		if opts.NoDirect {
+			file, err = os.Open(filePath)
+		} else {
+			file, err = openFileForWarmup(filePath)
+			if directUnsupported(err) && opts.DirectOnly {
+				err = fmt.Errorf("%w, %s may not support O_DIRECT", err, filesystemType(filePath))
+			} else if directUnsupported(err) {
+				if file, err = os.Open(filePath); err == nil {
+					progress.buffered = true
+					fsType := filesystemType(filePath)
+					if !directFallbacks[fsType] {
+						directFallbacks[fsType] = true
+						logger.Warnf("%s doesn't support O_DIRECT (%s), reading its files through page cache\n", fsType, filePath)
+					}
+					logger.Debugf("Opened %s without O_DIRECT\n", filePath)
+				}
+			}
+		}
+		if err != nil {
+			logger.Errorf("Error opening file: %v\n", err)
+			errs = append(errs, err)
+			progress.abort(err)
+			continue
+		}
+		progress.file = file
+		progress.evictAfter = opts.EvictAfter && (opts.NoDirect || progress.buffered)
+		files = append(files, progress)
+	}
+
+	// Bytes of the heads and tails going to be warmed, when reading just those
+	var headBytes, tailBytes int64
+	var regionFiles int
+
+	// Separate small and large files
+	var smallFiles []*fileProgress
+	var largeFiles []*fileProgress
+	for _, progress := range files {
+		fileInfo, err := progress.file.Stat()
+		if err != nil {
+			logger.Errorf("Error getting file info: %v\n", err)
+			errs = append(errs, err)
+			progress.abort(err)
+			continue
+		}
+		progress.device, progress.hasDevice = deviceID(fileInfo)
+		progress.size, err = fileSize(progress.file, fileInfo)
+		if err != nil {
+			logger.Errorf("Error getting file size: %v\n", err)
+			errs = append(errs, err)
+			progress.abort(err)
+			continue
+		}
+
+		// Nothing to read, done right away instead of going through a group
+		if progress.size == 0 {
+			logger.Debugf("Skipping empty file: %s\n", progress.path)
+			progress.start(0, 0)
+			continue
+		}
+
+		blockSize := opts.BlockSizeForLargeFiles
+		if progress.size <= opts.SmallFileSizeThreshold {
+			blockSize = opts.BlockSizeForSmallFiles
+			smallFiles = append(smallFiles, progress)
+		} else {
+			largeFiles = append(largeFiles, progress)
+		}
+		if opts.TouchOnly {
+			progress.touch = touchSize(blockSize, opts.NoDirect || progress.buffered)
+		}
+
+		// Only the blocks covering the range count, so progress still ends at 100%
+		if progress.byteRange == nil && progress.tail == 0 {
+			counters.BytesTotal.Add(progress.size)
+			continue
+		}
+		regions := regionSpans(progress.byteRange, progress.tail, progress.size, blockSize)
+		var bytes int64
+		for _, region := range regions {
+			bytes += spanBytes(region.start, region.end, progress.size, blockSize)
+		}
+		if progress.byteRange != nil {
+			first, end := progress.byteRange.blocks(progress.size, blockSize)
+			if progress.hasher != nil {
+				progress.hasher.restrict(first*blockSize, *progress.byteRange)
+			}
+			// Head is rounded up for most files, only ranges given for a file are worth a note
+			if _, ok := opts.Ranges[filepath.Clean(progress.path)]; ok && !progress.byteRange.aligned(progress.size, blockSize) {
+				logger.Infof("Range of %s rounded to block boundaries: bytes %d to %d\n", progress.path, first*blockSize, min(end*blockSize, progress.size))
+			}
+		}
+		// A head merged with the tail counts as head as far as it goes
+		if progress.tail > 0 {
+			head := int64(0)
+			if progress.byteRange != nil {
+				first, end := progress.byteRange.blocks(progress.size, blockSize)
+				head = spanBytes(first, end, progress.size, blockSize)
+			}
+			headBytes += head
+			tailBytes += bytes - head
+			regionFiles++
+			for _, region := range regions {
+				logger.Debugf("Warming bytes %d to %d of %s\n", region.start*blockSize, min(region.end*blockSize, progress.size), progress.path)
+			}
+		}
+		counters.BytesTotal.Add(bytes)
+	}
+	if regionFiles > 0 {
+		logger.Infof("Warming %.2f MB of heads and %.2f MB of tails of %d files\n", float64(headBytes)/1024/1024, float64(tailBytes)/1024/1024, regionFiles)
+	}
+
+	// Stable, so files of the same size keep the input order
+	if opts.Order == OrderSizeDesc {
+		bySizeDesc := func(a, b *fileProgress) int {
+			return cmp.Compare(b.size, a.size)
+		}
+		slices.SortStableFunc(smallFiles, bySizeDesc)
+		slices.SortStableFunc(largeFiles, bySizeDesc)
+	}
+
+	if backend, ok := lookupBackend(opts.Method); ok {
+		errs = append(errs, warmWithBackend(ctx, append(smallFiles, largeFiles...), backend, opts, counters, logger))
+	} else {
+		// A single pool for all disks, unless every disk gets its own
+		disks := []*diskFiles{{small: smallFiles, large: largeFiles}}
+		largeWorkers := opts.LargeFilesWorkerCount
+		if opts.WorkersPerDisk > 0 {
+			disks = splitByDevice(smallFiles, largeFiles)
+			largeWorkers = opts.WorkersPerDisk
+			logger.Infof("Warming up files on %d disks with a pool of %d workers each\n", len(disks), largeWorkers)
+			for _, disk := range disks {
+				logger.Debugf("Device %#x: %d small and %d large files\n", disk.device, len(disk.small), len(disk.large))
+			}
+		}
+
+		// Disks are warmed at the same time, so a slow one doesn't hold back the others
+		var mu sync.Mutex
+		var disksWg sync.WaitGroup
+		for _, disk := range disks {
+			disksWg.Add(1)
+			go func() {
+				defer disksWg.Done()
+
+				var wg sync.WaitGroup
+				wg.Add(2)
+
+				// Always run a single thread for small files
+				small := newFileGroup(opts, opts.BlockSizeForSmallFiles, opts.SmallFilesWorkerCount, limiter, pinner, counters, logger)
+				large := newFileGroup(opts, opts.BlockSizeForLargeFiles, largeWorkers, limiter, pinner, counters, logger)
+				err := errors.Join(
+					warmupFileGroup(ctx, disk.small, small, &wg),
+					warmupFileGroup(ctx, disk.large, large, &wg),
+				)
+
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}()
+		}
+		disksWg.Wait()
+	}
+
+	// Files are closed as soon as they are warmed, this catches the ones that failed or never got dispatched
+	for _, progress := range files {
+		progress.close()
+	}
+	return progresses, errors.Join(errs...)
+}
+
+// fileGroup is how the small or the large files of a warmup are read, the options with what's resolved per group
+// The limiter, pinner and counters are shared by all groups of the warmup
+type fileGroup struct {
+	opts          Options
+	blockSize     int64
+	blocksPerRead int
+	workers       int
+	// Streams every file is read in with stride, 0 reads a file in a single stream
+	streams  int
+	limiter  *rate.Limiter
+	pinner   *cpuPinner
+	counters *Counters
+	logger   *Logger
+}
+
+func newFileGroup(opts Options, blockSize int64, workers int, limiter *rate.Limiter, pinner *cpuPinner, counters *Counters, logger *Logger) *fileGroup {
+	group := &fileGroup{
+		opts:          opts,
+		blockSize:     blockSize,
+		blocksPerRead: opts.readBlocks(blockSize),
+		workers:       workers,
+		limiter:       limiter,
+		pinner:        pinner,
+		counters:      counters,
+		logger:        logger,
+	}
+	// A stream per worker, so every worker has reads of its own region in flight
+	if opts.Stride {
+		group.streams = workers
+	}
+	return group
+}
+
+// startWorker runs a worker on a goroutine of the pool, or on one of its own without a pool
+func (group *fileGroup) startWorker(worker func(*workerState)) {
+	if group.opts.Pool != nil {
+		group.opts.Pool.run(group.opts.IOPriority, worker)
+		return
+	}
+	go func() {
+		state := &workerState{}
+		defer state.close()
+		worker(state)
+	}()
+}
+
+func warmupFileGroup(ctx context.Context, files []*fileProgress, group *fileGroup, wg *sync.WaitGroup) error {
+	defer wg.Done()
+	blockSize, blocksPerRead, workersCount, logger := group.blockSize, group.blocksPerRead, group.workers, group.logger
+	fileConcurrency, perDiskConcurrency := group.opts.FileConcurrency, group.opts.PerDiskConcurrency
+
+	if len(files) == 0 {
+		logger.Debugf("No files to warmup\n")
+		return nil
+	}
+
+	// Find the largest file size
+	// To calculate length of channel, the blocks of every file are counted from its own size
+	// The sizes were found when the files were opened, no need to stat them again
+	var largestFileSize int64
+	for _, progress := range files {
+		largestFileSize = max(largestFileSize, progress.size)
+	}
+
+	maxBlocks := (largestFileSize + blockSize - 1) / blockSize
+	maxRuns := (maxBlocks + int64(blocksPerRead) - 1) / int64(blocksPerRead)
+	logger.Debugf("Warming up %d files with %d workers, blocks of %d bytes\n", len(files), workersCount, blockSize)
+
+	// Files are handed out to fileConcurrency lanes, each with its own channel and workers
+	// Memory for buffers grows with it, every lane has workersCount workers
+	lanes := min(fileConcurrency, len(files))
+	if lanes > 1 {
+		logger.Infof("Warming up %d files at a time with %d workers each\n", lanes, workersCount)
+	}
+	if perDiskConcurrency > 0 {
+		devices := make(map[uint64]int)
+		for _, progress := range files {
+			devices[progress.device]++
+		}
+		for device, count := range devices {
+			logger.Debugf("Device %#x: %d files, at most %d at a time\n", device, count, perDiskConcurrency)
+		}
+	}
+	queue := newFileQueue(files, perDiskConcurrency)
+
+	var mu sync.Mutex
+	var errs []error
+	var laneWg sync.WaitGroup
+	for lane := 0; lane < lanes; lane++ {
+		laneWg.Add(1)
+		go func() {
+			defer laneWg.Done()
+
+			// Create a channel for block numbers
+			// Keep a couple of pending requests per worker so no worker waits on the producer
+			blockChan := make(chan fileReadRequest, min(int64(workersCount*2), maxRuns))
+
+			// Create a WaitGroup to wait for all workers to finish
+			var workerWg sync.WaitGroup
+
+			// Start exactly workersCount workers to drain the channel
+			// The pool is shared by all files of the lane, requests carry the file they belong to
+			// So workers pick up blocks of the next file while the last ones of the previous file are read
+			for i := 0; i < workersCount; i++ {
+				workerWg.Add(1)
+				group.startWorker(func(state *workerState) {
+					warmupWorker(ctx, blockChan, group, state, &workerWg)
+				})
+			}
+
+			err := dispatchFiles(ctx, queue, blockChan, group)
+
+			// Close the channel
+			close(blockChan)
+
+			// Wait for all workers to finish
+			workerWg.Wait()
+
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		}()
+	}
+	laneWg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// warmWithBackend hands the files to a backend one after the other, e.g. to let the kernel readahead machinery pull them into page cache
+// No blocks are read by us, so no workers are needed
+func warmWithBackend(ctx context.Context, files []*fileProgress, backend Backend, opts Options, counters *Counters, logger *Logger) error {
+	var errs []error
+	for _, progress := range files {
+		if ctx.Err() != nil {
+			break
+		}
+
+		file := progress.file
+		logger.Infof("Prefetching file: %s\n", file.Name())
+		progress.begin(ctx, opts.FileTimeout)
+		progress.start(1, progress.size)
+		counters.BlocksTotal.Add(1)
+		err := backend.Warm(progress.ctx, file, progress.size, opts)
+		if progress.ctx.Err() != nil && ctx.Err() == nil {
+			err = context.Cause(progress.ctx)
+		}
+		if err != nil {
+			logger.Errorf("Error prefetching file: %v\n", err)
+			err = fmt.Errorf("prefetch %s: %w", file.Name(), err)
+			errs = append(errs, err)
+			progress.fail(err)
+			progress.complete(1, 0)
+			continue
+		}
+		progress.complete(1, progress.size)
+	}
+	return errors.Join(errs...)
+}
+
+func warmupWorker(ctx context.Context, blockChan chan fileReadRequest, group *fileGroup, state *workerState, wg *sync.WaitGroup) {
+	defer wg.Done()
+	blockSize, blocksPerRead, limiter, pinner, logger := group.blockSize, group.blocksPerRead, group.limiter, group.pinner, group.logger
+	// Falls back to psync for this worker when its ring can't be set up
+	method, retries, ioPriority, histogram := group.opts.Method, group.opts.Retries, group.opts.IOPriority, group.opts.Histogram
+
+	// Pinned before anything is allocated, so the buffers come from memory near the CPU
+	if pinner != nil {
+		state.pinned = true
+		if cpu, err := pinner.pin(logger); err != nil {
+			logger.Warnf("Error pinning worker to CPU %d, it may migrate: %v\n", cpu, err)
+		}
+	}
+
+	// The priority applies per thread, every worker sets it for its own
+	// A worker of a pool may already have it from an earlier warmup
+	if ioPriority != state.ioPriority {
+		if err := setThreadIOPriority(ioPriority); err != nil {
+			logger.Warnf("Error setting I/O priority, reading with the default one: %v\n", err)
+		} else {
+			state.ioPriority = ioPriority
+		}
+	}
+
+	// Latencies are kept per worker and handed to the files once it's done, reads don't contend on a lock
+	var latencies latencyRecorder
+	if histogram {
+		latencies = latencyRecorder{}
+		defer latencies.flush()
+	}
+
+	// Create buffers for each worker, one per block of a run
+	// To avoid internal sync lock on buffer pool sync.pool
+	buffers := state.readBuffers(blockSize, blocksPerRead)
+
+	var batch *ioUringBatch
+	var err error
+
+	if method == IOUring {
+		batch, err = state.ioUringBatch(blockSize, retries, logger)
+		if err != nil {
+			// Still warm our share of the blocks, just without io_uring
+			logger.Warnf("Error creating iouring, falling back to psync: %v\n", err)
+			method = PosixSync
+		} else {
+			batch.latencies = latencies
+		}
+	}
+
+	for {
+		var details fileReadRequest
+		var ok bool
+		select {
+		case <-ctx.Done():
+			// Drop the pending batch, nothing is in flight at this point
+			if batch != nil {
+				batch.reset()
+			}
+			return
+		case details, ok = <-blockChan:
+		}
+		if !ok {
+			break
+		}
+
+		// The file timed out while the blocks were queued, the next file's blocks are up
+		fileCtx := details.progress.ctx
+		if fileCtx.Err() != nil {
+			details.progress.skip(details.blocks)
+			continue
+		}
+
+		// Charge what can actually be read, the last run may reach past the end of file
+		// Only fails once the file context is done
+		length := min(int64(details.blocks)*blockSize, max(details.progress.size-details.offset, 0))
+		// The limiter already fails when the wait would exceed the deadline, the file is given up on then anyway
+		if err := waitRate(fileCtx, limiter, length); err != nil {
+			<-fileCtx.Done()
+			details.progress.skip(details.blocks)
+			continue
+		}
+
+		// Submit requests in batches
+		if method == IOUring {
+			for i := 0; i < details.blocks; i++ {
+				err := batch.add(details.fd, details.offset+int64(i)*blockSize, details.progress)
+				if err != nil {
+					logger.Errorf("Error submitting requests: %v\n", err)
+				}
+			}
+		}
+
+		// Just read the run with a single syscall in case of PosixSync
+		if method == PosixSync {
+			reader := newFileReader(details.progress.file)
+			readStart := time.Now()
+			n, err := readWithRetries(fileCtx, retries, logger, details.progress.path, details.offset, func() (int, error) {
+				if details.progress.touch > 0 {
+					return touchBlocks(reader, buffers[0][:details.progress.touch], details.offset, details.blocks, blockSize, details.progress.size)
+				}
+				if details.blocks == 1 {
+					return preadFull(reader, buffers[0], details.offset)
+				}
+				return preadvFull(reader, buffers[:details.blocks], details.offset)
+			})
+			latencies.record(details.progress, time.Since(readStart))
+			if details.progress.hasher != nil && (err == nil || err == io.EOF) {
+				details.progress.hasher.write(details.offset, buffers[:details.blocks], n)
+			}
+			if err != nil && err != io.EOF {
+				// The block the read stopped at is the one that failed
+				offset := details.offset + int64(n)/blockSize*blockSize
+				if details.progress.failBlock(offset, err) {
+					logger.Errorf("Error reading block at offset %d of %s: %v\n", offset, details.progress.path, err)
+				}
+			} else {
+				details.progress.readBlock()
+				evictRead(details.progress, details.fd, details.offset, int64(n), logger)
+			}
+			details.progress.complete(details.blocks, int64(n))
+			if err != nil {
+				continue
+			}
+		}
+
+		// Let the kernel pull the run into page cache
+		if method == ReadAhead {
+			readStart := time.Now()
+			_, err := readWithRetries(fileCtx, retries, logger, details.progress.path, details.offset, func() (int, error) {
+				return 0, readahead(details.fd, details.offset, length)
+			})
+			latencies.record(details.progress, time.Since(readStart))
+			if err != nil {
+				if details.progress.failBlock(details.offset, err) {
+					logger.Errorf("Error readahead of block at offset %d of %s: %v\n", details.offset, details.progress.path, err)
+				}
+				details.progress.complete(details.blocks, 0)
+				continue
+			}
+			details.progress.readBlock()
+			details.progress.complete(details.blocks, length)
+		}
+	}
+
+	if method == IOUring {
+		// Submit any remaining requests
+		if err := batch.submit(); err != nil {
+			logger.Errorf("Error submitting requests: %v\n", err)
+		}
+	}
+}
+
+// waitRate blocks until n bytes may be read, a nil limiter never blocks
+func waitRate(ctx context.Context, limiter *rate.Limiter, n int64) error {
+	if limiter == nil {
+		return nil
+	}
+	return limiter.WaitN(ctx, int(n))
+}
+
+// alignedBuffer returns a buffer starting at a page boundary
+// O_DIRECT reads fail with EINVAL if the buffer isn't aligned, and Go makes no alignment guarantee
+func alignedBuffer(size int64) []byte {
+	alignment := os.Getpagesize()
+	buffer := make([]byte, int(size)+alignment)
+	offset := 0
+	if remainder := int(uintptr(unsafe.Pointer(&buffer[0])) % uintptr(alignment)); remainder != 0 {
+		offset = alignment - remainder
+	}
+	return buffer[offset : offset+int(size) : offset+int(size)]
+}
+
+// preadFull keeps reading until the buffer is full or the end of file is reached
+// On Unix it calls pread(2) on the descriptor directly, nothing is allocated per block
+// A single pread is allowed to return fewer bytes than requested
+func preadFull(r fileReader, buffer []byte, offset int64) (int, error) {
+	return readFullAt(r, buffer, offset)
+}
+
+// readFullAt is preadFull for any reader, short reads without an error are read on from where they stopped
+// Generic rather than taking an io.ReaderAt, so a descriptor isn't boxed into an interface for every block
+func readFullAt[R io.ReaderAt](r R, buffer []byte, offset int64) (int, error) {
+	total := 0
+	for total < len(buffer) {
+		n, err := r.ReadAt(buffer[total:], offset+int64(total))
+		if n > 0 {
+			total += n
+		}
+		if err != nil {
+			return total, err
+		}
+		// O_DIRECT only stops short of an aligned length at the end of file
+		if n == 0 || int64(total)%directIOAlignment != 0 {
+			break
+		}
+	}
+	return total, nil
+}
+
+// preadvFull reads a run of consecutive blocks, with a single syscall unless it comes back short
+func preadvFull(r fileReader, buffers [][]byte, offset int64) (int, error) {
+	total, err := preadv(r, buffers, offset)
+	if err != nil || total <= 0 {
+		return max(total, 0), err
+	}
+
+	// Finish a short read block by block
+	skip := total
+	for _, buffer := range buffers {
+		if skip >= len(buffer) {
+			skip -= len(buffer)
+			continue
+		}
+		// O_DIRECT only stops short of an aligned length at the end of file
+		if int64(total)%directIOAlignment != 0 {
+			break
+		}
+		n, err := preadFull(r, buffer[skip:], offset+int64(total))
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n < len(buffer)-skip {
+			break
+		}
+		skip = 0
+	}
+	return total, nil
+}
+
+// O_DIRECT requires every read offset and length to be aligned to the logical sector size
+func ValidateBlockSize(blockSize int64) error {
+	if blockSize <= 0 {
+		return fmt.Errorf("block size must be positive, got %d", blockSize)
+	}
+	if blockSize%directIOAlignment != 0 {
+		return fmt.Errorf("block size %d is not a multiple of %d bytes", blockSize, directIOAlignment)
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package warmer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// writeTestFile creates a file of size bytes in dir, with data that isn't all zeros
+func writeTestFile(t testing.TB, dir, name string, size int) string {
+	t.Helper()
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// testOptions reads through page cache, temporary directories may be on a filesystem without O_DIRECT
+func testOptions() Options {
+	return Options{
+		Method:                 PosixSync,
+		SmallFileSizeThreshold: 64 * 1024,
+		BlockSizeForSmallFiles: 4096,
+		BlockSizeForLargeFiles: 64 * 1024,
+		SmallFilesWorkerCount:  1,
+		LargeFilesWorkerCount:  4,
+		NoDirect:               true,
+		Logger:                 NewLogger(io.Discard, LevelError),
+	}
+}
+
+// shortReader returns at most chunk bytes per read, without an error like pread(2)
+type shortReader struct {
+	data  []byte
+	chunk int
+	// Returned once failAfter bytes were read, nil never fails
+	err       error
+	failAfter int
+	reads     int
+}
+
+func (r *shortReader) ReadAt(buffer []byte, offset int64) (int, error) {
+	r.reads++
+	if r.err != nil && offset >= int64(r.failAfter) {
+		return 0, r.err
+	}
+	if offset >= int64(len(r.data)) {
+		return 0, nil
+	}
+	return copy(buffer[:min(len(buffer), r.chunk)], r.data[offset:]), nil
+}
+
+func TestReadFullAtShortReads(t *testing.T) {
+	data := make([]byte, 64*1024+1000)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	tests := []struct {
+		name   string
+		reader *shortReader
+		offset int64
+		size   int
+		want   int
+		reads  int
+		err    error
+	}{
+		{"fills the buffer", &shortReader{data: data, chunk: 4096}, 0, 16384, 16384, 4, nil},
+		{"a single read", &shortReader{data: data, chunk: 1 << 20}, 0, 16384, 16384, 1, nil},
+		{"sector sized reads", &shortReader{data: data, chunk: 512}, 512, 4096, 4096, 8, nil},
+		{"unaligned end of file", &shortReader{data: data, chunk: 4096}, 64 * 1024, 4096, 1000, 1, nil},
+		{"aligned end of file", &shortReader{data: data[:8192], chunk: 4096}, 0, 16384, 8192, 3, nil},
+		{"at end of file", &shortReader{data: data, chunk: 4096}, int64(len(data)), 4096, 0, 1, nil},
+		{"error after a short read", &shortReader{data: data, chunk: 4096, err: syscall.EIO, failAfter: 4096}, 0, 16384, 4096, 2, syscall.EIO},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buffer := make([]byte, test.size)
+			n, err := readFullAt(test.reader, buffer, test.offset)
+			if n != test.want || !errors.Is(err, test.err) {
+				t.Fatalf("readFullAt = %d, %v, want %d, %v", n, err, test.want, test.err)
+			}
+			if test.reader.reads != test.reads {
+				t.Fatalf("readFullAt took %d reads, want %d", test.reader.reads, test.reads)
+			}
+			if !bytes.Equal(buffer[:n], data[test.offset:test.offset+int64(n)]) {
+				t.Fatal("readFullAt returned other bytes than the ones at the offset")
+			}
+		})
+	}
+}
+
+func TestReadFullAtEOF(t *testing.T) {
+	// A strict io.ReaderAt stops with io.EOF, the bytes read before are kept
+	n, err := readFullAt(bytes.NewReader(make([]byte, 1000)), make([]byte, 4096), 0)
+	if n != 1000 || err != io.EOF {
+		t.Fatalf("readFullAt = %d, %v, want 1000, io.EOF", n, err)
+	}
+}
+
+func TestPreadFullDoesNotAllocate(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "file", 64*1024)
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader := newFileReader(file)
+	buffer := make([]byte, 4096)
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := preadFull(reader, buffer, 0); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("preadFull allocated %v times per block", allocs)
+	}
+}
+
+func TestAlignedBuffer(t *testing.T) {
+	pageSize := uintptr(os.Getpagesize())
+	for _, size := range []int64{512, 4096, 256 * 1024, 1024*1024 + 512} {
+		buffer := alignedBuffer(size)
+		if address := uintptr(unsafe.Pointer(&buffer[0])); address%pageSize != 0 {
+			t.Errorf("buffer of %d bytes at %#x, not aligned to %d", size, address, pageSize)
+		}
+		// A longer buffer would read past the block, a shorter one not all of it
+		if int64(len(buffer)) != size || int64(cap(buffer)) != size {
+			t.Errorf("buffer of %d bytes has length %d and capacity %d", size, len(buffer), cap(buffer))
+		}
+	}
+}
+
+func TestDirectReadOfUnalignedTail(t *testing.T) {
+	const size = 3*4096 + 1000
+	path := writeTestFile(t, t.TempDir(), "file", size)
+	file, err := openFileForWarmup(path)
+	if directUnsupported(err) {
+		t.Skipf("O_DIRECT is not supported here: %v", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader := newFileReader(file)
+
+	// The last block is read up to the end of file, not failed for its unaligned length
+	n, err := preadFull(reader, alignedBuffer(4096), 3*4096)
+	if err != nil || n != 1000 {
+		t.Fatalf("preadFull of the last block = %d, %v, want 1000 bytes", n, err)
+	}
+	n, err = preadvFull(reader, [][]byte{alignedBuffer(4096), alignedBuffer(4096)}, 2*4096)
+	if err != nil || n != 4096+1000 {
+		t.Fatalf("preadvFull of the last two blocks = %d, %v, want %d bytes", n, err, 4096+1000)
+	}
+
+	opts := testOptions()
+	opts.NoDirect = false
+	opts.DirectOnly = true
+	result, err := Warm(context.Background(), []string{path}, opts)
+	if err != nil || result.TotalBytes != size {
+		t.Fatalf("Warm with O_DIRECT = %d bytes, %v, want %d bytes", result.TotalBytes, err, size)
+	}
+}
+
+// benchmarkFileSize is large enough for the reads to dominate, the file stays in page cache once written
+const benchmarkFileSize = 256 * 1024 * 1024
+
+// BenchmarkBlockReads compares reading a file with a pread per block to runs of blocks read with a single preadv
+// Reads go through page cache, so what differs is the syscalls per byte read
+// Blocks of 4K make the syscalls count, as they do for small files
+func BenchmarkBlockReads(b *testing.B) {
+	const blockSize = 4096
+	path := writeTestFile(b, b.TempDir(), "file", benchmarkFileSize)
+	file, err := os.Open(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer file.Close()
+	reader := newFileReader(file)
+
+	for _, blocksPerRead := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("blocks per read %d", blocksPerRead), func(b *testing.B) {
+			buffers := make([][]byte, blocksPerRead)
+			for i := range buffers {
+				buffers[i] = alignedBuffer(blockSize)
+			}
+			b.SetBytes(benchmarkFileSize)
+			for i := 0; i < b.N; i++ {
+				for offset := int64(0); offset < benchmarkFileSize; offset += int64(blocksPerRead) * blockSize {
+					var err error
+					if blocksPerRead == 1 {
+						_, err = preadFull(reader, buffers[0], offset)
+					} else {
+						_, err = preadvFull(reader, buffers, offset)
+					}
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkBlockReadAllocs reads a block per op, with pread on the descriptor and with a section reader made for every block
+// The section reader is how blocks used to be read, it allocates for every block
+func BenchmarkBlockReadAllocs(b *testing.B) {
+	const blockSize, blocks = 4096, 256
+	path := writeTestFile(b, b.TempDir(), "file", blockSize*blocks)
+	file, err := os.Open(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer file.Close()
+	buffer := alignedBuffer(blockSize)
+
+	b.Run("pread", func(b *testing.B) {
+		reader := newFileReader(file)
+		b.ReportAllocs()
+		b.SetBytes(blockSize)
+		for i := 0; i < b.N; i++ {
+			if _, err := preadFull(reader, buffer, int64(i%blocks)*blockSize); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("section reader", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(blockSize)
+		for i := 0; i < b.N; i++ {
+			if _, err := io.ReadFull(io.NewSectionReader(file, int64(i%blocks)*blockSize, blockSize), buffer); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"file_warmer/warmer"
+)
+
+// A file is only warmed once it wasn't written for this long, writers may close and reopen it a few times
+const watchDebounce = time.Second
+
+// runWatch warms the files completed in dirs until ctx is done, one batch of the files that settled at a time
+// A file written again after being warmed is warmed again
+func runWatch(ctx context.Context, dirs []string, recursive bool, opts warmer.Options, logger *warmer.Logger) int {
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err == nil && !info.IsDir() {
+			err = fmt.Errorf("%s is not a directory", dir)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --watch: %v\n", err)
+			return exitUsage
+		}
+	}
+	watcher, err := newDirWatcher(dirs, recursive)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error watching: %v\n", err)
+		return exitFailure
+	}
+	defer watcher.close()
+
+	// Events keep coming in while a batch is warmed, inotify only holds so many
+	files := make(chan string, 1024)
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- watcher.run(files, func(err error) {
+			logger.Warnf("Error watching: %v\n", err)
+		})
+	}()
+
+	logger.Infof("Watching %d directories for new files\n", len(dirs))
+	ticker := time.NewTicker(watchDebounce / 2)
+	defer ticker.Stop()
+	// Last time each file was completed, in the order they first were
+	lastWritten := make(map[string]time.Time)
+	var order []string
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Infof("Watch stopped: %v\n", context.Cause(ctx))
+			return exitSuccess
+		case err := <-watchErr:
+			logger.Errorf("Error watching: %v\n", err)
+			return exitFailure
+		case path := <-files:
+			if _, ok := lastWritten[path]; !ok {
+				order = append(order, path)
+			}
+			lastWritten[path] = time.Now()
+			continue
+		case <-ticker.C:
+		}
+
+		var settled []string
+		pending := order[:0]
+		for _, path := range order {
+			if time.Since(lastWritten[path]) < watchDebounce {
+				pending = append(pending, path)
+				continue
+			}
+			settled = append(settled, path)
+			delete(lastWritten, path)
+		}
+		order = pending
+		if len(settled) == 0 {
+			continue
+		}
+
+		logger.Infof("Warming %d new files\n", len(settled))
+		stats, err := warmer.Warm(ctx, settled, opts)
+		if err != nil {
+			logger.Errorf("Error: %v\n", err)
+		}
+		logger.Infof("Warmed %d new files: %.2f MB at %.2f MB/s\n", stats.FileCount-stats.FailedFiles, float64(stats.TotalBytes)/1024/1024, stats.ThroughputMBs)
+	}
+}
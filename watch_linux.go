@@ -0,0 +1,131 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Files are only reported once written and closed or moved in whole, a file being written isn't complete yet
+const watchFileEvents = unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO
+
+// New subdirectories are watched too with recursive
+const watchDirEvents = unix.IN_CREATE | unix.IN_MOVED_TO
+
+// dirWatcher reports the files completed in the watched directories, with inotify
+// https://man7.org/linux/man-pages/man7/inotify.7.html
+type dirWatcher struct {
+	file      *os.File
+	recursive bool
+	// Watch descriptors of the directories, events only carry the name within the directory
+	dirs map[int]string
+}
+
+func newDirWatcher(dirs []string, recursive bool) (*dirWatcher, error) {
+	// Non-blocking, so reads go through the runtime poller and close unblocks them
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify: %w", err)
+	}
+	w := &dirWatcher{file: os.NewFile(uintptr(fd), "inotify"), recursive: recursive, dirs: make(map[int]string)}
+	for _, dir := range dirs {
+		if _, err := w.add(dir); err != nil {
+			w.close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// add watches dir, and its subdirectories with recursive
+// Files already in subdirectories are returned, a new directory may have been filled before its watch was added
+func (w *dirWatcher) add(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			if entry.Type().IsRegular() {
+				files = append(files, path)
+			}
+			return nil
+		}
+		if path != dir && !w.recursive {
+			return filepath.SkipDir
+		}
+		mask := uint32(watchFileEvents)
+		if w.recursive {
+			mask |= watchDirEvents
+		}
+		wd, err := unix.InotifyAddWatch(int(w.file.Fd()), path, mask|unix.IN_ONLYDIR)
+		if err != nil {
+			return &os.PathError{Op: "inotify_add_watch", Path: path, Err: err}
+		}
+		w.dirs[wd] = path
+		return nil
+	})
+	return files, err
+}
+
+// run sends the paths of completed files until the watcher is closed, warn gets the errors it carries on after
+func (w *dirWatcher) run(files chan<- string, warn func(error)) error {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("reading inotify events: %w", err)
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+int(event.Len)]
+			offset += unix.SizeofInotifyEvent + int(event.Len)
+
+			if event.Mask&unix.IN_Q_OVERFLOW != 0 {
+				warn(errors.New("inotify queue overflowed, some new files weren't warmed"))
+				continue
+			}
+			dir, ok := w.dirs[int(event.Wd)]
+			if !ok {
+				continue
+			}
+			if event.Mask&unix.IN_IGNORED != 0 {
+				delete(w.dirs, int(event.Wd))
+				continue
+			}
+			path := filepath.Join(dir, string(bytes.TrimRight(nameBytes, "\x00")))
+
+			if event.Mask&unix.IN_ISDIR != 0 {
+				if w.recursive && event.Mask&watchDirEvents != 0 {
+					existing, err := w.add(path)
+					if err != nil {
+						warn(err)
+					}
+					for _, file := range existing {
+						files <- file
+					}
+				}
+				continue
+			}
+			if event.Mask&watchFileEvents != 0 {
+				files <- path
+			}
+		}
+	}
+}
+
+func (w *dirWatcher) close() {
+	w.file.Close()
+}
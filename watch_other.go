@@ -0,0 +1,17 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+type dirWatcher struct{}
+
+func newDirWatcher(dirs []string, recursive bool) (*dirWatcher, error) {
+	return nil, errors.New("watching directories needs inotify, it's only supported on Linux")
+}
+
+func (w *dirWatcher) run(files chan<- string, warn func(error)) error {
+	return nil
+}
+
+func (w *dirWatcher) close() {}